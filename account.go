@@ -0,0 +1,476 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/workpool"
+	"github.com/google/uuid"
+)
+
+const (
+	accountDeletionGracePeriod = 30 * 24 * time.Hour
+	accountPurgeInterval       = time.Hour
+	// Accounts without a password confirm deletion by having signed in
+	// this recently instead.
+	accountDeletionReauthWindow = 10 * time.Minute
+
+	// Accounts with more chirps than this can only be exported in the
+	// background.
+	exportSyncChirpLimit = 1000
+	exportRetention      = 7 * 24 * time.Hour
+	// A background export is reused rather than started again for this
+	// long, and is given up on if it makes no progress for exportLease,
+	// say because the server restarted.
+	exportReuseInterval = 24 * time.Hour
+	exportLease         = 15 * time.Minute
+
+	exportFormatZIP  = "zip"
+	exportFormatJSON = "json"
+
+	exportStatusPending = "pending"
+	exportStatusReady   = "ready"
+)
+
+// deleteAccount schedules the caller's account for deletion after a grace
+// period and signs it out everywhere. Signing in again before then keeps
+// the account. The password confirms the request; accounts without one,
+// which were created through OIDC, must have signed in recently.
+func (cfg *apiConfig) deleteAccount(res http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+	type deletionResponse struct {
+		DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+	}
+
+	user, ok := cfg.authenticatedUser(res, req)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if hasPassword(user) {
+		match, err := cfg.checkPassword(req.Context(), params.Password, user.HashedPassword)
+		if errors.Is(err, workpool.ErrSaturated) {
+			cfg.respondPasswordPoolBusy(res)
+			return
+		}
+		if err != nil || !match {
+			respondWithError(res, http.StatusUnauthorized, "Incorrect password", err)
+			return
+		}
+	} else {
+		recent, err := cfg.signedInRecently(req.Context(), requestPrincipal(req).SessionID)
+		if err != nil {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't delete account", err)
+			return
+		}
+		if !recent {
+			respondWithError(res, http.StatusForbidden, "Sign in again to delete your account", nil)
+			return
+		}
+	}
+
+	if auth.Role(user.Role) == auth.RoleAdmin {
+		admins, err := cfg.dbQueries.CountUsersByRole(req.Context(), string(auth.RoleAdmin))
+		if err != nil {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't delete account", err)
+			return
+		}
+		if admins <= 1 {
+			respondWithError(res, http.StatusConflict, "Can't delete the last admin account", nil)
+			return
+		}
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't delete account", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	user, err = qtx.ScheduleUserDeletion(req.Context(), database.ScheduleUserDeletionParams{
+		DeletionScheduledAt: sql.NullTime{Time: time.Now().UTC().Add(accountDeletionGracePeriod), Valid: true},
+		ID:                  user.ID,
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't delete account", err)
+		return
+	}
+
+	err = qtx.RevokeAllSessions(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't delete account", err)
+		return
+	}
+
+	err = qtx.RevokeAllRefreshTokens(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't delete account", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't delete account", err)
+		return
+	}
+	cfg.tokenVersions.Set(user.ID, user.TokenVersion)
+	if requestPrincipal(req).Method == authMethodSessionCookie {
+		clearSessionCookies(res)
+	}
+
+	respondWithJSON(res, http.StatusAccepted, deletionResponse{
+		DeletionScheduledAt: user.DeletionScheduledAt.Time,
+	})
+}
+
+// signedInRecently reports whether the session was started by a sign-in
+// within accountDeletionReauthWindow. Refreshing a session doesn't count.
+func (cfg *apiConfig) signedInRecently(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	if sessionID == uuid.Nil {
+		return false, nil
+	}
+	session, err := cfg.dbQueries.GetActiveSession(ctx, sessionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return session.CreatedAt.After(time.Now().UTC().Add(-accountDeletionReauthWindow)), nil
+}
+
+// purgeDeletedAccounts hard deletes accounts whose grace period has ended.
+// Everything they own goes with them through the foreign keys. It also
+// fails background exports abandoned by a restart so they can be requested
+// again.
+func (cfg *apiConfig) purgeDeletedAccounts(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := cfg.dbQueries.DeleteScheduledUsers(ctx)
+		if err != nil {
+			log.Printf("Error deleting accounts: %s", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %d accounts at the end of their grace period", deleted)
+		}
+
+		err = cfg.dbQueries.DeleteExpiredDataExports(ctx)
+		if err != nil {
+			log.Printf("Error deleting expired data exports: %s", err)
+		}
+
+		stale, err := cfg.dbQueries.FailStaleDataExports(ctx, time.Now().UTC().Add(-exportLease))
+		if err != nil {
+			log.Printf("Error failing stale data exports: %s", err)
+		} else if stale > 0 {
+			log.Printf("Failed %d data exports abandoned while pending", stale)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type DataExport struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Format    string    `json:"format"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+func newDataExport(export database.DataExport) DataExport {
+	return DataExport{
+		ID:        export.ID,
+		CreatedAt: export.CreatedAt,
+		ExpiresAt: export.ExpiresAt,
+		Format:    export.Format,
+		Status:    export.Status,
+		Error:     export.Error.String,
+	}
+}
+
+// exportFormat reads the archive format from ?format=, zip by default.
+func exportFormat(req *http.Request) (string, bool) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatZIP
+	}
+	return format, format == exportFormatZIP || format == exportFormatJSON
+}
+
+// exportAccount responds with the caller's data as a ZIP archive, or a single
+// JSON document with ?format=json. It only reads, so accounts too large to
+// export within one request are exported in the background by
+// createDataExport instead.
+func (cfg *apiConfig) exportAccount(res http.ResponseWriter, req *http.Request) {
+	userID := requestPrincipal(req).UserID
+
+	format, ok := exportFormat(req)
+	if !ok {
+		respondWithError(res, http.StatusBadRequest, "format must be zip or json", nil)
+		return
+	}
+
+	chirps, err := cfg.dbQueries.CountChirpsByUserID(req.Context(), userID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't export account", err)
+		return
+	}
+	if chirps > exportSyncChirpLimit {
+		respondWithError(res, http.StatusConflict, "Account is too large to export at once, use POST /api/users/me/exports", nil)
+		return
+	}
+
+	archive, err := cfg.buildAccountArchive(req.Context(), userID, format)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't export account", err)
+		return
+	}
+	writeAccountArchive(res, format, archive)
+}
+
+// createDataExport starts exporting the caller's data in the background and
+// points at /api/users/me/exports/{exportID}, where it is picked up once
+// ready. An export that is still running, or finished within
+// exportReuseInterval, is handed out again instead of starting another.
+func (cfg *apiConfig) createDataExport(res http.ResponseWriter, req *http.Request) {
+	userID := requestPrincipal(req).UserID
+
+	format, ok := exportFormat(req)
+	if !ok {
+		respondWithError(res, http.StatusBadRequest, "format must be zip or json", nil)
+		return
+	}
+
+	now := time.Now().UTC()
+	export, err := cfg.dbQueries.GetReusableDataExport(req.Context(), database.GetReusableDataExportParams{
+		UserID:       userID,
+		Format:       format,
+		CreatedAfter: now.Add(-exportReuseInterval),
+		PendingAfter: now.Add(-exportLease),
+	})
+	if err == nil {
+		res.Header().Set("Location", "/api/users/me/exports/"+export.ID.String())
+		if export.Status == exportStatusPending {
+			res.Header().Set("Retry-After", "5")
+		}
+		respondWithJSON(res, http.StatusAccepted, newDataExport(export))
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't export account", err)
+		return
+	}
+
+	export, err = cfg.dbQueries.CreateDataExport(req.Context(), database.CreateDataExportParams{
+		ExpiresAt: now.Add(exportRetention),
+		Format:    format,
+		UserID:    userID,
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't export account", err)
+		return
+	}
+	go cfg.runDataExport(export)
+
+	res.Header().Set("Location", "/api/users/me/exports/"+export.ID.String())
+	res.Header().Set("Retry-After", "5")
+	respondWithJSON(res, http.StatusAccepted, newDataExport(export))
+}
+
+func (cfg *apiConfig) getDataExport(res http.ResponseWriter, req *http.Request) {
+	exportID, err := uuid.Parse(req.PathValue("exportID"))
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Invalid export ID", err)
+		return
+	}
+
+	export, err := cfg.dbQueries.GetDataExport(req.Context(), database.GetDataExportParams{
+		ID:     exportID,
+		UserID: requestPrincipal(req).UserID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusNotFound, "Couldn't find export", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't get export", err)
+		return
+	}
+
+	switch export.Status {
+	case exportStatusReady:
+		writeAccountArchive(res, export.Format, export.Archive)
+	case exportStatusPending:
+		res.Header().Set("Retry-After", "5")
+		respondWithJSON(res, http.StatusAccepted, newDataExport(export))
+	default:
+		respondWithJSON(res, http.StatusOK, newDataExport(export))
+	}
+}
+
+func (cfg *apiConfig) runDataExport(export database.DataExport) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	archive, err := cfg.buildAccountArchive(ctx, export.UserID, export.Format)
+	if err != nil {
+		log.Printf("Error building export %s: %s", export.ID, err)
+		err = cfg.dbQueries.FailDataExport(ctx, database.FailDataExportParams{
+			Error: sql.NullString{String: err.Error(), Valid: true},
+			ID:    export.ID,
+		})
+		if err != nil {
+			log.Printf("Error saving export %s: %s", export.ID, err)
+		}
+		return
+	}
+
+	err = cfg.dbQueries.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		Archive: archive,
+		ID:      export.ID,
+	})
+	if err != nil {
+		log.Printf("Error saving export %s: %s", export.ID, err)
+	}
+}
+
+// buildAccountArchive collects the user's profile, chirps and sessions. Secrets
+// such as password hashes and TOTP seeds are left out.
+func (cfg *apiConfig) buildAccountArchive(ctx context.Context, userID uuid.UUID, format string) ([]byte, error) {
+	type profile struct {
+		ID              uuid.UUID  `json:"id"`
+		CreatedAt       time.Time  `json:"created_at"`
+		UpdatedAt       time.Time  `json:"updated_at"`
+		Email           string     `json:"email"`
+		EmailVerifiedAt *time.Time `json:"email_verified_at"`
+		Role            auth.Role  `json:"role"`
+		ChirpyRed       bool       `json:"is_chirpy_red"`
+		TOTPEnabled     bool       `json:"totp_enabled"`
+	}
+	type chirp struct {
+		ID        uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+		Body      string    `json:"body"`
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+	chirpyRed, err := cfg.isChirpyRed(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting subscription: %w", err)
+	}
+	dbChirps, err := cfg.dbQueries.GetChirpsByUserIDAsc(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting chirps: %w", err)
+	}
+	dbSessions, err := cfg.dbQueries.GetSessionsByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting sessions: %w", err)
+	}
+
+	userProfile := profile{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Email:       user.Email,
+		Role:        auth.Role(user.Role),
+		ChirpyRed:   chirpyRed,
+		TOTPEnabled: user.TotpEnabledAt.Valid,
+	}
+	if user.EmailVerifiedAt.Valid {
+		userProfile.EmailVerifiedAt = &user.EmailVerifiedAt.Time
+	}
+	chirps := []chirp{}
+	for _, c := range dbChirps {
+		chirps = append(chirps, chirp{ID: c.ID, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt, Body: c.Body})
+	}
+	sessions := []Session{}
+	for _, session := range dbSessions {
+		sessions = append(sessions, Session{
+			ID:         session.ID,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IpAddress,
+		})
+	}
+
+	if format == exportFormatJSON {
+		return json.MarshalIndent(map[string]any{
+			"exported_at": time.Now().UTC(),
+			"profile":     userProfile,
+			"chirps":      chirps,
+			"sessions":    sessions,
+		}, "", "  ")
+	}
+
+	buf := bytes.Buffer{}
+	archive := zip.NewWriter(&buf)
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", userProfile},
+		{"chirps.json", chirps},
+		{"sessions.json", sessions},
+	}
+	for _, file := range files {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			return nil, fmt.Errorf("error writing %s: %w", file.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeAccountArchive(res http.ResponseWriter, format string, archive []byte) {
+	if format == exportFormatJSON {
+		res.Header().Set("Content-Type", "application/json")
+	} else {
+		res.Header().Set("Content-Type", "application/zip")
+	}
+	res.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.`+format+`"`)
+	res.WriteHeader(http.StatusOK)
+	res.Write(archive)
+}
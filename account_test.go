@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+)
+
+func TestDeleteAccountWithoutPassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		sessionID  uuid.UUID
+		signedInAt time.Time
+		wantStatus int
+	}{
+		{name: "Recent sign-in", sessionID: uuid.New(), signedInAt: time.Now().UTC().Add(-time.Minute), wantStatus: http.StatusAccepted},
+		{name: "Old sign-in", sessionID: uuid.New(), signedInAt: time.Now().UTC().Add(-time.Hour), wantStatus: http.StatusForbidden},
+		{name: "No session", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			user := testUser()
+			expectQuery(mock, "GetUserByID").WithArgs(user.ID).WillReturnRows(userRows(user))
+			if tt.sessionID != uuid.Nil {
+				expectQuery(mock, "GetActiveSession").WithArgs(tt.sessionID).WillReturnRows(sessionRows(tt.sessionID, user.ID, tt.signedInAt))
+			}
+			if tt.wantStatus == http.StatusAccepted {
+				scheduled := user
+				scheduled.DeletionScheduledAt = sql.NullTime{Time: time.Now().UTC().Add(accountDeletionGracePeriod), Valid: true}
+				mock.ExpectBegin()
+				expectQuery(mock, "ScheduleUserDeletion").WillReturnRows(userRows(scheduled))
+				expectExec(mock, "RevokeAllSessions").WillReturnResult(sqlmock.NewResult(0, 1))
+				expectExec(mock, "RevokeAllRefreshTokens").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/users/me", strings.NewReader(`{}`))
+			req = withPrincipal(req, &Principal{UserID: user.ID, Method: authMethodAccessToken, SessionID: tt.sessionID})
+			res := httptest.NewRecorder()
+			cfg.deleteAccount(res, req)
+
+			if res.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", res.Code, tt.wantStatus, res.Body)
+			}
+		})
+	}
+}
+
+func TestCreateDataExportReusesExport(t *testing.T) {
+	for _, status := range []string{exportStatusPending, exportStatusReady} {
+		t.Run(status, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			userID := uuid.New()
+			now := time.Now().UTC()
+			exportID := uuid.New()
+
+			expectQuery(mock, "GetReusableDataExport").WithArgs(userID, exportFormatZIP, sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at", "expires_at", "format", "status", "archive", "error", "user_id"}).
+					AddRow(exportID.String(), now, now, now.Add(exportRetention), exportFormatZIP, status, nil, nil, userID.String()))
+
+			req := withPrincipal(httptest.NewRequest(http.MethodPost, "/api/users/me/exports", nil), &Principal{UserID: userID})
+			res := httptest.NewRecorder()
+			cfg.createDataExport(res, req)
+
+			if res.Code != http.StatusAccepted {
+				t.Errorf("status = %d, want %d: %s", res.Code, http.StatusAccepted, res.Body)
+			}
+			if got, want := res.Header().Get("Location"), "/api/users/me/exports/"+exportID.String(); got != want {
+				t.Errorf("Location = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestExportAccountDoesNotStartExports(t *testing.T) {
+	cfg, mock := newTestConfig(t)
+	userID := uuid.New()
+	expectQuery(mock, "CountChirpsByUserID").WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(exportSyncChirpLimit + 1))
+
+	req := withPrincipal(httptest.NewRequest(http.MethodGet, "/api/users/me/export", nil), &Principal{UserID: userID})
+	res := httptest.NewRecorder()
+	cfg.exportAccount(res, req)
+
+	if res.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d: %s", res.Code, http.StatusConflict, res.Body)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/google/uuid"
+)
+
+// requireRole only lets requests through when the caller, already resolved
+// by RequireAuth, holds at least role. The role claim is checked against the
+// database as well, so a demoted admin loses access straight away instead of
+// when their token expires.
+func (cfg *apiConfig) requireRole(role auth.Role, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		principal := requestPrincipal(req)
+		if !principal.Role.Includes(role) {
+			respondWithError(res, http.StatusForbidden, "Forbidden", nil)
+			return
+		}
+
+		user, err := cfg.dbQueries.GetUserByID(req.Context(), principal.UserID)
+		if err != nil {
+			respondWithError(res, http.StatusUnauthorized, "Couldn't find user", err)
+			return
+		}
+		if !auth.Role(user.Role).Includes(role) {
+			respondWithError(res, http.StatusForbidden, "Forbidden", nil)
+			return
+		}
+
+		next.ServeHTTP(res, req)
+	})
+}
+
+func (cfg *apiConfig) setUserRole(res http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Role string `json:"role"`
+	}
+	type roleResponse struct {
+		ID        uuid.UUID `json:"id"`
+		UpdatedAt time.Time `json:"updated_at"`
+		Email     string    `json:"email"`
+		Role      auth.Role `json:"role"`
+	}
+
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	role, err := auth.ParseRole(params.Role)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusNotFound, "Couldn't find user", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	if auth.Role(user.Role) == auth.RoleAdmin && role != auth.RoleAdmin {
+		admins, err := cfg.dbQueries.CountUsersByRole(req.Context(), string(auth.RoleAdmin))
+		if err != nil {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't update role", err)
+			return
+		}
+		if admins <= 1 {
+			respondWithError(res, http.StatusConflict, "Can't demote the last admin", nil)
+			return
+		}
+	}
+
+	user, err = cfg.dbQueries.SetUserRole(req.Context(), database.SetUserRoleParams{
+		Role: string(role),
+		ID:   userID,
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't update role", err)
+		return
+	}
+	cfg.tokenVersions.Set(user.ID, user.TokenVersion)
+	log.Printf("Role of user %s set to %s", user.ID, role)
+
+	respondWithJSON(res, http.StatusOK, roleResponse{
+		ID:        user.ID,
+		UpdatedAt: user.UpdatedAt,
+		Email:     user.Email,
+		Role:      auth.Role(user.Role),
+	})
+}
+
+// suspendUser locks a user out. Their sessions are revoked and the token
+// version bump invalidates the access tokens they already hold.
+func (cfg *apiConfig) suspendUser(res http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't suspend user", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	user, err := qtx.SuspendUser(req.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusNotFound, "Couldn't find user", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't suspend user", err)
+		return
+	}
+
+	err = qtx.RevokeAllSessions(req.Context(), userID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't suspend user", err)
+		return
+	}
+
+	err = qtx.RevokeAllRefreshTokens(req.Context(), userID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't suspend user", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't suspend user", err)
+		return
+	}
+	cfg.tokenVersions.Set(user.ID, user.TokenVersion)
+
+	log.Printf("User %s suspended", user.ID)
+	res.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unsuspendUser(res http.ResponseWriter, req *http.Request) {
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+
+	_, err = cfg.dbQueries.UnsuspendUser(req.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusNotFound, "Couldn't find user", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't unsuspend user", err)
+		return
+	}
+
+	log.Printf("User %s unsuspended", userID)
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// bootstrapAdmin promotes an existing account to admin so a new deployment
+// has someone who can reach /admin. It refuses once any admin exists; from
+// then on roles are granted through PUT /admin/users/{userID}/role.
+func bootstrapAdmin(ctx context.Context, q *database.Queries, email string) error {
+	admins, err := q.CountUsersByRole(ctx, string(auth.RoleAdmin))
+	if err != nil {
+		return fmt.Errorf("error counting admins: %w", err)
+	}
+	if admins > 0 {
+		return errors.New("an admin already exists")
+	}
+
+	user, err := q.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no user with email %q, sign up first", email)
+	}
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	_, err = q.SetUserRole(ctx, database.SetUserRoleParams{
+		Role: string(auth.RoleAdmin),
+		ID:   user.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("error setting role: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/google/uuid"
+)
+
+// Browser sessions keep the access and refresh tokens in HttpOnly cookies so
+// the /app/ frontend never handles them. Clients opt in with ?mode=cookie on
+// /api/login, /api/login/mfa and /api/login/magic/redeem.
+const (
+	accessTokenCookie  = "chirpy_access_token"
+	refreshTokenCookie = "chirpy_refresh_token"
+	csrfCookie         = "chirpy_csrf_token"
+	csrfHeader         = "X-CSRF-Token"
+	csrfFormField      = "csrf_token"
+	// The refresh token is only ever read by these endpoints.
+	refreshTokenCookiePath = "/api/"
+)
+
+func cookieMode(req *http.Request) bool {
+	return req.URL.Query().Get("mode") == "cookie"
+}
+
+// csrfToken is derived from the session rather than stored, so it stays the
+// same across refreshes and a token planted in the cookie jar by another
+// site can't match someone else's session.
+func (cfg *apiConfig) csrfToken(sessionID uuid.UUID) string {
+	return auth.HashToken("csrf:"+sessionID.String(), cfg.tokenHashKey)
+}
+
+// checkCSRF requires the X-CSRF-Token header, or a csrf_token field for
+// HTML forms, on requests that change state. Other sites can make the
+// browser send our cookies but can't read the CSRF cookie to copy it.
+func (cfg *apiConfig) checkCSRF(req *http.Request, sessionID uuid.UUID) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	token := req.Header.Get(csrfHeader)
+	if token == "" {
+		token = req.PostFormValue(csrfFormField)
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.csrfToken(sessionID))) == 1
+}
+
+func (cfg *apiConfig) setSessionCookies(res http.ResponseWriter, sessionID uuid.UUID, accessToken, refreshToken string, accessExpiresAt, refreshExpiresAt time.Time) {
+	setAccessTokenCookie(res, accessToken, accessExpiresAt)
+	http.SetCookie(res, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    refreshToken,
+		Path:     refreshTokenCookiePath,
+		Expires:  refreshExpiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	// Readable by the frontend, which echoes it back in the CSRF header.
+	http.SetCookie(res, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    cfg.csrfToken(sessionID),
+		Path:     "/",
+		Expires:  refreshExpiresAt,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func setAccessTokenCookie(res http.ResponseWriter, accessToken string, expiresAt time.Time) {
+	http.SetCookie(res, &http.Cookie{
+		Name:     accessTokenCookie,
+		Value:    accessToken,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func clearSessionCookies(res http.ResponseWriter) {
+	for name, path := range map[string]string{
+		accessTokenCookie:  "/",
+		refreshTokenCookie: refreshTokenCookiePath,
+		csrfCookie:         "/",
+	} {
+		http.SetCookie(res, &http.Cookie{
+			Name:     name,
+			Path:     path,
+			MaxAge:   -1,
+			HttpOnly: name != csrfCookie,
+			Secure:   true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+}
+
+// refreshTokenFromRequest prefers a bearer token and falls back to the
+// refresh cookie, reporting which one it used.
+func refreshTokenFromRequest(req *http.Request) (token string, fromCookie bool, err error) {
+	if req.Header.Get("Authorization") != "" {
+		token, err = auth.GetBearerToken(req.Header)
+		return token, false, err
+	}
+	cookie, err := req.Cookie(refreshTokenCookie)
+	if err != nil {
+		return "", false, err
+	}
+	return cookie.Value, true, nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// The access cookie is only sent on requests started from this site;
+// authorize relies on it to bounce users arriving from OAuth clients.
+func TestAccessTokenCookieIsStrict(t *testing.T) {
+	res := httptest.NewRecorder()
+	setAccessTokenCookie(res, "token", time.Now().Add(time.Hour))
+
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != accessTokenCookie {
+		t.Fatalf("cookies = %v, want %s", cookies, accessTokenCookie)
+	}
+	if cookies[0].SameSite != http.SameSiteStrictMode || !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Errorf("cookie = %+v, want HttpOnly, Secure and SameSite=Strict", cookies[0])
+	}
+}
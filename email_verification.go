@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const emailVerificationDuration = 24 * time.Hour
+
+// sendVerificationEmail mails a confirmation link for email, which is either
+// the account's current address or the one it is changing to.
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.dbQueries.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token, cfg.tokenHashKey),
+		ExpiresAt: time.Now().UTC().Add(emailVerificationDuration),
+		Email:     email,
+		UserID:    userID,
+	})
+	if err != nil {
+		return fmt.Errorf("error saving verification token: %w", err)
+	}
+
+	cfg.sendMail(mailer.Message{
+		To:      email,
+		Subject: "Confirm your email for Chirpy",
+		Body: fmt.Sprintf("Open this link within 24 hours to confirm %s for your Chirpy account:\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.\n",
+			email, cfg.baseURL+"/app/verify-email.html?token="+url.QueryEscape(token)),
+	})
+	return nil
+}
+
+func (cfg *apiConfig) verifyEmail(res http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	token, err := cfg.dbQueries.ConsumeEmailVerificationToken(req.Context(), auth.HashToken(params.Token, cfg.tokenHashKey))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusBadRequest, "Verification token is invalid or expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	_, err = cfg.dbQueries.MarkEmailVerified(req.Context(), database.MarkEmailVerifiedParams{
+		ID:    token.UserID,
+		Email: token.Email,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = cfg.dbQueries.ApplyPendingEmail(req.Context(), database.ApplyPendingEmailParams{
+			ID:    token.UserID,
+			Email: token.Email,
+		})
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusBadRequest, "Email address no longer matches the account", err)
+		return
+	}
+	if isUniqueViolation(err) {
+		respondWithError(res, http.StatusConflict, "Email address is already in use", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't verify email", err)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) resendVerificationEmail(res http.ResponseWriter, req *http.Request) {
+	user, ok := cfg.authenticatedUser(res, req)
+	if !ok {
+		return
+	}
+
+	email := user.Email
+	if user.PendingEmail.Valid {
+		email = user.PendingEmail.String
+	} else if user.EmailVerifiedAt.Valid {
+		respondWithError(res, http.StatusConflict, "Email is already verified", nil)
+		return
+	}
+
+	err := cfg.sendVerificationEmail(req.Context(), user.ID, email)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't send verification email", err)
+		return
+	}
+
+	res.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	impersonationDuration = 15 * time.Minute
+
+	auditActionImpersonationStart   = "impersonation.start"
+	auditActionImpersonationStop    = "impersonation.stop"
+	auditActionImpersonationRequest = "impersonation.request"
+)
+
+type AuditLogEntry struct {
+	ID              uuid.UUID  `json:"id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	Action          string     `json:"action"`
+	ActorID         uuid.UUID  `json:"actor_id"`
+	UserID          uuid.UUID  `json:"user_id"`
+	ImpersonationID *uuid.UUID `json:"impersonation_id"`
+	Request         string     `json:"request,omitempty"`
+	Status          int32      `json:"status,omitempty"`
+}
+
+func newAuditLogEntry(entry database.AuditLog) AuditLogEntry {
+	resp := AuditLogEntry{
+		ID:        entry.ID,
+		CreatedAt: entry.CreatedAt,
+		Action:    entry.Action,
+		ActorID:   entry.ActorID,
+		UserID:    entry.UserID,
+		Request:   entry.Request.String,
+		Status:    entry.Status.Int32,
+	}
+	if entry.ImpersonationID.Valid {
+		resp.ImpersonationID = &entry.ImpersonationID.UUID
+	}
+	return resp
+}
+
+// startImpersonation mints a short-lived access token for the target user
+// that carries the admin in its act claim. Admins can't be impersonated, so
+// the token never grants more than the admin already has.
+func (cfg *apiConfig) startImpersonation(res http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Reason string `json:"reason"`
+	}
+	type impersonationResponse struct {
+		ImpersonationID uuid.UUID `json:"impersonation_id"`
+		UserID          uuid.UUID `json:"user_id"`
+		ExpiresAt       time.Time `json:"expires_at"`
+		Token           string    `json:"token"`
+	}
+
+	userID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Invalid user ID", err)
+		return
+	}
+	adminID := requestPrincipal(req).UserID
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if strings.TrimSpace(params.Reason) == "" {
+		respondWithError(res, http.StatusBadRequest, "A reason is required", nil)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusNotFound, "Couldn't find user", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+	if user.ID == adminID || auth.Role(user.Role) == auth.RoleAdmin {
+		respondWithError(res, http.StatusForbidden, "Admins can't be impersonated", nil)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't start impersonation", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	impersonation, err := qtx.CreateImpersonation(req.Context(), database.CreateImpersonationParams{
+		ExpiresAt: time.Now().UTC().Add(impersonationDuration),
+		Reason:    strings.TrimSpace(params.Reason),
+		AdminID:   adminID,
+		UserID:    user.ID,
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't start impersonation", err)
+		return
+	}
+
+	err = qtx.CreateAuditLogEntry(req.Context(), database.CreateAuditLogEntryParams{
+		Action:          auditActionImpersonationStart,
+		ActorID:         adminID,
+		UserID:          user.ID,
+		ImpersonationID: uuid.NullUUID{UUID: impersonation.ID, Valid: true},
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't start impersonation", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't start impersonation", err)
+		return
+	}
+
+	token, err := auth.MakeJWT(
+		user.ID,
+		cfg.jwtKeys,
+		impersonationDuration,
+		auth.WithRole(auth.Role(user.Role)),
+		auth.WithTokenVersion(user.TokenVersion),
+		auth.WithImpersonation(adminID, impersonation.ID),
+	)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+	log.Printf("Admin %s started impersonating user %s: %s", adminID, user.ID, impersonation.Reason)
+
+	respondWithJSON(res, http.StatusCreated, impersonationResponse{
+		ImpersonationID: impersonation.ID,
+		UserID:          user.ID,
+		ExpiresAt:       impersonation.ExpiresAt,
+		Token:           token,
+	})
+}
+
+// stopImpersonation ends an impersonation, which revokes its token.
+func (cfg *apiConfig) stopImpersonation(res http.ResponseWriter, req *http.Request) {
+	impersonationID, err := uuid.Parse(req.PathValue("impersonationID"))
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Invalid impersonation ID", err)
+		return
+	}
+	adminID := requestPrincipal(req).UserID
+
+	impersonation, err := cfg.dbQueries.EndImpersonation(req.Context(), impersonationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusNotFound, "Couldn't find an active impersonation", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't stop impersonation", err)
+		return
+	}
+
+	cfg.audit(req.Context(), database.CreateAuditLogEntryParams{
+		Action:          auditActionImpersonationStop,
+		ActorID:         adminID,
+		UserID:          impersonation.UserID,
+		ImpersonationID: uuid.NullUUID{UUID: impersonation.ID, Valid: true},
+	})
+	log.Printf("Admin %s stopped impersonation %s of user %s", adminID, impersonation.ID, impersonation.UserID)
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) listAuditLog(res http.ResponseWriter, req *http.Request) {
+	userID := uuid.NullUUID{}
+	if value := req.URL.Query().Get("user_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			respondWithError(res, http.StatusBadRequest, "Invalid user ID", err)
+			return
+		}
+		userID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	limit := 50
+	if value := req.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 500 {
+			respondWithError(res, http.StatusBadRequest, "limit must be between 1 and 500", err)
+			return
+		}
+		limit = n
+	}
+
+	dbEntries, err := cfg.dbQueries.ListAuditLogEntries(req.Context(), database.ListAuditLogEntriesParams{
+		UserID:     userID,
+		MaxEntries: int32(limit),
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't get audit log", err)
+		return
+	}
+
+	entries := []AuditLogEntry{}
+	for _, entry := range dbEntries {
+		entries = append(entries, newAuditLogEntry(entry))
+	}
+	respondWithJSON(res, http.StatusOK, entries)
+}
+
+// audit writes an audit log entry. Failing to write one is logged rather
+// than failing a request that has already been handled.
+func (cfg *apiConfig) audit(ctx context.Context, entry database.CreateAuditLogEntryParams) {
+	err := cfg.dbQueries.CreateAuditLogEntry(ctx, entry)
+	if err != nil {
+		log.Printf("Error writing audit log entry %s for user %s: %s", entry.Action, entry.UserID, err)
+	}
+}
+
+// auditImpersonatedRequest runs next and records every mutating request made
+// with an impersonation token, including ones that were refused.
+func (cfg *apiConfig) auditImpersonatedRequest(res http.ResponseWriter, req *http.Request, principal *Principal, next http.Handler) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		next.ServeHTTP(res, req)
+		return
+	}
+
+	recorder := &statusRecorder{ResponseWriter: res, status: http.StatusOK}
+	next.ServeHTTP(recorder, req)
+
+	cfg.audit(req.Context(), database.CreateAuditLogEntryParams{
+		Action:          auditActionImpersonationRequest,
+		ActorID:         principal.ActorID,
+		UserID:          principal.UserID,
+		ImpersonationID: uuid.NullUUID{UUID: principal.ImpersonationID, Valid: true},
+		Request:         sql.NullString{String: req.Method + " " + req.URL.Path, Valid: true},
+		Status:          sql.NullInt32{Int32: int32(recorder.status), Valid: true},
+	})
+}
+
+// denyImpersonation guards actions an impersonator must not take on the
+// user's behalf, such as changing their password or deleting their account.
+func denyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if principal := requestPrincipal(req); principal != nil && principal.Impersonating() {
+			respondWithError(res, http.StatusForbidden, "Not allowed while impersonating", nil)
+			return
+		}
+		next.ServeHTTP(res, req)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
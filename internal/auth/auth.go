@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -21,10 +23,25 @@ var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
 const (
 	// TokenTypeAccess -
 	TokenTypeAccess TokenType = "chirpy"
+	// TokenTypeMFAPending is issued after a correct password for accounts
+	// with two-factor authentication and can only be exchanged at /api/login/mfa.
+	TokenTypeMFAPending TokenType = "chirpy-mfa"
 )
 
+// passwordParams are the argon2id parameters new password hashes are made
+// with. They are set once at startup, before any hashing happens.
+var passwordParams = argon2id.DefaultParams
+
+func SetPasswordParams(params *argon2id.Params) {
+	passwordParams = params
+}
+
+func PasswordParams() argon2id.Params {
+	return *passwordParams
+}
+
 func HashPassword(pswd string) (string, error) {
-	hash, err := argon2id.CreateHash(pswd, argon2id.DefaultParams)
+	hash, err := argon2id.CreateHash(pswd, passwordParams)
 	if err != nil {
 		return "", fmt.Errorf("error creating password hash: %w", err)
 	}
@@ -41,15 +58,81 @@ func CheckPasswordHash(pswd, hash string) (bool, error) {
 
 }
 
-func MakeJWT(userId uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	JWTtoken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		Subject:   userId.String(),
+// NeedsRehash reports whether hash was made with weaker parameters than the
+// current ones and should be replaced the next time the password is known.
+func NeedsRehash(hash string) (bool, error) {
+	params, _, _, err := argon2id.DecodeHash(hash)
+	if err != nil {
+		return false, fmt.Errorf("error decoding password hash: %w", err)
+	}
+	return WeakerPasswordParams(params), nil
+}
+
+// WeakerPasswordParams reports whether any of the cost parameters in params
+// fall below the current ones.
+func WeakerPasswordParams(params *argon2id.Params) bool {
+	return params.Memory < passwordParams.Memory ||
+		params.Iterations < passwordParams.Iterations ||
+		params.Parallelism < passwordParams.Parallelism ||
+		params.SaltLength < passwordParams.SaltLength ||
+		params.KeyLength < passwordParams.KeyLength
+}
+
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	SessionID string `json:"sid,omitempty"`
+	Role      Role   `json:"role,omitempty"`
+	// TokenVersion must match the user's current token version; bumping it
+	// revokes every access token issued before.
+	TokenVersion int32 `json:"ver"`
+	// Actor is set on impersonation tokens only.
+	Actor *Actor `json:"act,omitempty"`
+	// ClientID and Scope are set on tokens issued to OAuth clients, which
+	// may only act within the scopes the user granted them.
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+}
+
+type ClaimOption func(*AccessClaims)
+
+func WithSessionID(sessionID uuid.UUID) ClaimOption {
+	return func(c *AccessClaims) {
+		c.SessionID = sessionID.String()
+	}
+}
+
+func WithTokenVersion(version int32) ClaimOption {
+	return func(c *AccessClaims) {
+		c.TokenVersion = version
+	}
+}
+
+func MakeJWT(userId uuid.UUID, keys *KeySet, expiresIn time.Duration, opts ...ClaimOption) (string, error) {
+	return makeToken(TokenTypeAccess, userId, keys, expiresIn, opts...)
+}
+
+// MakeMFAToken gives each token a random ID so the server can make sure it is
+// only exchanged once.
+func MakeMFAToken(userId uuid.UUID, keys *KeySet, expiresIn time.Duration) (string, error) {
+	return makeToken(TokenTypeMFAPending, userId, keys, expiresIn, func(c *AccessClaims) {
+		c.ID = uuid.NewString()
 	})
+}
+
+func makeToken(tokenType TokenType, userId uuid.UUID, keys *KeySet, expiresIn time.Duration, opts ...ClaimOption) (string, error) {
+	claims := AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    string(tokenType),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			Subject:   userId.String(),
+		},
+	}
+	for _, opt := range opts {
+		opt(&claims)
+	}
 
-	signedToken, err := JWTtoken.SignedString([]byte(tokenSecret))
+	signedToken, err := keys.sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("error signing token: %w", err)
 	}
@@ -58,51 +141,90 @@ func MakeJWT(userId uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claimsStruct := jwt.RegisteredClaims{}
+func ValidateJWT(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, keys)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID()
+}
+
+func ValidateMFAToken(tokenString string, keys *KeySet) (uuid.UUID, error) {
+	claims, err := ParseMFAToken(tokenString, keys)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return claims.UserID()
+}
+
+func ParseMFAToken(tokenString string, keys *KeySet) (*AccessClaims, error) {
+	return parseToken(tokenString, keys, TokenTypeMFAPending)
+}
+
+func ParseJWT(tokenString string, keys *KeySet) (*AccessClaims, error) {
+	return parseToken(tokenString, keys, TokenTypeAccess)
+}
+
+func parseToken(tokenString string, keys *KeySet, tokenType TokenType) (*AccessClaims, error) {
+	claimsStruct := AccessClaims{}
 	token, err := jwt.ParseWithClaims(
 		tokenString,
 		&claimsStruct,
-		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
+		keys.keyFunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
 	)
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
 
 	if !token.Valid {
-		return uuid.Nil, errors.New("invalid token")
-	}
-
-	userIDString, err := claimsStruct.GetSubject()
-	if err != nil {
-		return uuid.Nil, err
+		return nil, errors.New("invalid token")
 	}
 
 	issuer, err := claimsStruct.GetIssuer()
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
-	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
+	if issuer != string(tokenType) {
+		return nil, errors.New("invalid issuer")
 	}
 
-	id, err := uuid.Parse(userIDString)
+	if _, err := claimsStruct.UserID(); err != nil {
+		return nil, err
+	}
+	return &claimsStruct, nil
+}
+
+func (c *AccessClaims) UserID() (uuid.UUID, error) {
+	id, err := uuid.Parse(c.Subject)
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
 	}
 	return id, nil
 }
 
+// Session returns the session the token was issued for, or uuid.Nil.
+func (c *AccessClaims) Session() uuid.UUID {
+	id, err := uuid.Parse(c.SessionID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
 		return "", ErrNoAuthHeaderIncluded
 	}
 
-	trimmed := strings.Split(authHeader, " ")
-	trimmed[1] = strings.Trim(trimmed[1], "")
+	scheme, key, found := strings.Cut(authHeader, " ")
+	key = strings.TrimSpace(key)
+	if !found || scheme != "ApiKey" || key == "" {
+		return "", errors.New("malformed authorization header")
+	}
 
-	return trimmed[1], nil
+	return key, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -128,3 +250,11 @@ func MakeRefreshToken() (string, error) {
 
 	return token, nil
 }
+
+// HashToken returns the keyed hash under which an opaque token is stored, so
+// a copy of the database alone can't be used to sign in.
+func HashToken(token string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
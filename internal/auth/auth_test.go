@@ -1,9 +1,11 @@
 package auth
 
 import (
+	"net/http"
 	"testing"
 	"time"
 
+	"github.com/alexedwards/argon2id"
 	"github.com/google/uuid"
 )
 
@@ -73,33 +75,43 @@ func TestAuth(t *testing.T) {
 
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	validToken, _ := MakeJWT(userID, "secret", time.Hour)
+	keys := newTestKeySet(t)
+	otherKeys := newTestKeySet(t)
+	validToken, _ := MakeJWT(userID, keys, time.Hour)
+	expiredToken, _ := MakeJWT(userID, keys, -time.Minute)
 
 	tests := []struct {
 		name        string
 		tokenString string
-		tokenSecret string
+		keys        *KeySet
 		wantUserID  uuid.UUID
 		wantErr     bool
 	}{
 		{
 			name:        "Valid token",
 			tokenString: validToken,
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserID:  userID,
 			wantErr:     false,
 		},
 		{
 			name:        "Invalid token",
 			tokenString: "invalid.token.string",
-			tokenSecret: "secret",
+			keys:        keys,
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
 		{
-			name:        "Wrong secret",
+			name:        "Unknown key",
 			tokenString: validToken,
-			tokenSecret: "wrong_secret",
+			keys:        otherKeys,
+			wantUserID:  uuid.Nil,
+			wantErr:     true,
+		},
+		{
+			name:        "Expired token",
+			tokenString: expiredToken,
+			keys:        keys,
 			wantUserID:  uuid.Nil,
 			wantErr:     true,
 		},
@@ -107,7 +119,7 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotUserID, err := ValidateJWT(tt.tokenString, tt.tokenSecret)
+			gotUserID, err := ValidateJWT(tt.tokenString, tt.keys)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ValidateJWT() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -118,3 +130,166 @@ func TestValidateJWT(t *testing.T) {
 		})
 	}
 }
+
+func TestSessionClaim(t *testing.T) {
+	keys := newTestKeySet(t)
+	sessionID := uuid.New()
+
+	token, err := MakeJWT(uuid.New(), keys, time.Hour, WithSessionID(sessionID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ParseJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if claims.Session() != sessionID {
+		t.Errorf("Session() = %v, want %v", claims.Session(), sessionID)
+	}
+
+	token, _ = MakeJWT(uuid.New(), keys, time.Hour)
+	claims, _ = ParseJWT(token, keys)
+	if claims.Session() != uuid.Nil {
+		t.Errorf("Session() = %v for a token without sid", claims.Session())
+	}
+}
+
+func TestMFATokenIsNotAnAccessToken(t *testing.T) {
+	keys := newTestKeySet(t)
+	userID := uuid.New()
+
+	mfaToken, err := MakeMFAToken(userID, keys, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(mfaToken, keys); err == nil {
+		t.Errorf("ValidateJWT() accepted an MFA token")
+	}
+	if got, err := ValidateMFAToken(mfaToken, keys); err != nil || got != userID {
+		t.Errorf("ValidateMFAToken() = %v, %v", got, err)
+	}
+
+	accessToken, _ := MakeJWT(userID, keys, time.Minute)
+	if _, err := ValidateMFAToken(accessToken, keys); err == nil {
+		t.Errorf("ValidateMFAToken() accepted an access token")
+	}
+}
+
+func TestMFATokenID(t *testing.T) {
+	keys := newTestKeySet(t)
+	userID := uuid.New()
+
+	first, _ := MakeMFAToken(userID, keys, time.Minute)
+	second, _ := MakeMFAToken(userID, keys, time.Minute)
+	a, err := ParseMFAToken(first, keys)
+	if err != nil {
+		t.Fatalf("ParseMFAToken() error = %v", err)
+	}
+	b, _ := ParseMFAToken(second, keys)
+	if _, err := uuid.Parse(a.ID); err != nil {
+		t.Errorf("MFA token ID = %q, want a UUID", a.ID)
+	}
+	if a.ID == b.ID {
+		t.Errorf("MFA tokens share the ID %q", a.ID)
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	key := []byte("hash-key")
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := HashToken(token, key)
+	if hash == token {
+		t.Errorf("HashToken() returned the raw token")
+	}
+	if HashToken(token, key) != hash {
+		t.Errorf("HashToken() is not deterministic")
+	}
+	if HashToken(token, []byte("other-key")) == hash {
+		t.Errorf("HashToken() ignores the key")
+	}
+}
+
+func newTestKeySet(t *testing.T) *KeySet {
+	t.Helper()
+	key, err := GenerateEd25519Key()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := NewKeySet()
+	if _, err := keys.Add(key, KeyStatusActive); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestNeedsRehash(t *testing.T) {
+	t.Cleanup(func() { SetPasswordParams(argon2id.DefaultParams) })
+
+	weak := *argon2id.DefaultParams
+	weak.Memory = 8 * 1024
+	SetPasswordParams(&weak)
+	oldHash, err := HashPassword("correctpswd123!")
+	if err != nil {
+		t.Fatalf("HashPassword() error = %v", err)
+	}
+
+	if rehash, err := NeedsRehash(oldHash); err != nil || rehash {
+		t.Errorf("NeedsRehash() with unchanged params = %v, %v", rehash, err)
+	}
+
+	SetPasswordParams(argon2id.DefaultParams)
+	if rehash, err := NeedsRehash(oldHash); err != nil || !rehash {
+		t.Errorf("NeedsRehash() after raising memory = %v, %v", rehash, err)
+	}
+	if match, err := CheckPasswordHash("correctpswd123!", oldHash); err != nil || !match {
+		t.Errorf("CheckPasswordHash() on old params = %v, %v", match, err)
+	}
+
+	if _, err := NeedsRehash("unset"); err == nil {
+		t.Errorf("NeedsRehash() accepted an invalid hash")
+	}
+}
+
+func TestTokenVersionClaim(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	token, err := MakeJWT(uuid.New(), keys, time.Hour, WithTokenVersion(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ParseJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if claims.TokenVersion != 7 {
+		t.Errorf("TokenVersion = %d, want 7", claims.TokenVersion)
+	}
+}
+
+func TestGetAPIKey(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    string
+		wantErr bool
+	}{
+		{header: "ApiKey abc123", want: "abc123"},
+		{header: "", wantErr: true},
+		{header: "ApiKey", wantErr: true},
+		{header: "ApiKey ", wantErr: true},
+		{header: "Bearer abc123", wantErr: true},
+	}
+	for _, tt := range tests {
+		headers := http.Header{}
+		if tt.header != "" {
+			headers.Set("Authorization", tt.header)
+		}
+		got, err := GetAPIKey(headers)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("GetAPIKey(%q) = %q, %v", tt.header, got, err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestImpersonationClaim(t *testing.T) {
+	keys := newTestKeySet(t)
+	userID, adminID, impersonationID := uuid.New(), uuid.New(), uuid.New()
+
+	token, err := MakeJWT(userID, keys, time.Minute, WithImpersonation(adminID, impersonationID))
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	claims, err := ParseJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	actor, id, ok := claims.Impersonation()
+	if !ok || actor != adminID || id != impersonationID {
+		t.Errorf("Impersonation() = %s, %s, %v, want %s, %s, true", actor, id, ok, adminID, impersonationID)
+	}
+	if subject, _ := claims.UserID(); subject != userID {
+		t.Errorf("UserID() = %s, want %s", subject, userID)
+	}
+
+	token, err = MakeJWT(userID, keys, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	claims, err = ParseJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if _, _, ok := claims.Impersonation(); ok {
+		t.Errorf("Impersonation() ok for an ordinary token")
+	}
+}
@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type KeyStatus string
+
+const (
+	// KeyStatusActive keys are published, accepted and may sign new tokens.
+	KeyStatusActive KeyStatus = "active"
+	// KeyStatusRetiring keys are published and accepted but never sign.
+	KeyStatusRetiring KeyStatus = "retiring"
+)
+
+var (
+	ErrNoSigningKey = errors.New("no active signing key")
+	ErrUnknownKeyID = errors.New("unknown key id")
+)
+
+type SigningKey struct {
+	ID      string
+	Status  KeyStatus
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+// KeySet holds the keys used to sign and verify access tokens. The first
+// active key signs; every key in the set is accepted during validation so
+// keys can be rotated without invalidating tokens already issued.
+type KeySet struct {
+	mu   sync.RWMutex
+	keys []*SigningKey
+}
+
+func NewKeySet() *KeySet {
+	return &KeySet{}
+}
+
+func (ks *KeySet) Add(private crypto.Signer, status KeyStatus) (*SigningKey, error) {
+	var method jwt.SigningMethod
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("rsa keys must be at least 2048 bits")
+		}
+		method = jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+
+	kid, err := thumbprint(private.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	for _, key := range ks.keys {
+		if key.ID == kid {
+			key.Status = status
+			return key, nil
+		}
+	}
+	key := &SigningKey{
+		ID:      kid,
+		Status:  status,
+		method:  method,
+		private: private,
+	}
+	ks.keys = append(ks.keys, key)
+	return key, nil
+}
+
+func (ks *KeySet) AddPEM(data []byte, status KeyStatus) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	var private any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %w", err)
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+	return ks.Add(signer, status)
+}
+
+func (ks *KeySet) LoadPEMFile(path string, status KeyStatus) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %w", err)
+	}
+	return ks.AddPEM(data, status)
+}
+
+func (ks *KeySet) Retire(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	for _, key := range ks.keys {
+		if key.ID == kid {
+			key.Status = KeyStatusRetiring
+			return nil
+		}
+	}
+	return ErrUnknownKeyID
+}
+
+func (ks *KeySet) Remove(kid string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	for i, key := range ks.keys {
+		if key.ID == kid {
+			ks.keys = append(ks.keys[:i], ks.keys[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	ks.mu.RLock()
+	var signer *SigningKey
+	for _, key := range ks.keys {
+		if key.Status == KeyStatusActive {
+			signer = key
+			break
+		}
+	}
+	ks.mu.RUnlock()
+	if signer == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(signer.method, claims)
+	token.Header["kid"] = signer.ID
+	return token.SignedString(signer.private)
+}
+
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for _, key := range ks.keys {
+		if key.ID != kid {
+			continue
+		}
+		if key.method.Alg() != token.Method.Alg() {
+			return nil, fmt.Errorf("key %s does not use %s", kid, token.Method.Alg())
+		}
+		return key.private.Public(), nil
+	}
+	return nil, ErrUnknownKeyID
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (ks *KeySet) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk, err := publicJWK(key.private.Public())
+		if err != nil {
+			continue
+		}
+		jwk.Kid = key.ID
+		jwk.Use = "sig"
+		jwk.Alg = key.method.Alg()
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func GenerateEd25519Key() (ed25519.PrivateKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating key: %w", err)
+	}
+	return private, nil
+}
+
+func publicJWK(public crypto.PublicKey) (JWK, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(k),
+		}, nil
+	}
+	return JWK{}, fmt.Errorf("unsupported key type %T", public)
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint used as the key id.
+func thumbprint(public crypto.PublicKey) (string, error) {
+	jwk, err := publicJWK(public)
+	if err != nil {
+		return "", err
+	}
+
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	dat, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(dat)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
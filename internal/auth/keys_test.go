@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestKeyRotation(t *testing.T) {
+	userID := uuid.New()
+	keys := newTestKeySet(t)
+	oldToken, err := MakeJWT(userID, keys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKID := keys.JWKS().Keys[0].Kid
+	if err := keys.Retire(oldKID); err != nil {
+		t.Fatalf("Retire() error = %v", err)
+	}
+	newKey, err := keys.Add(rsaKey, KeyStatusActive)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	newToken, err := MakeJWT(userID, keys, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	for name, token := range map[string]string{"retiring key": oldToken, "new key": newToken} {
+		if got, err := ValidateJWT(token, keys); err != nil || got != userID {
+			t.Errorf("%s: ValidateJWT() = %v, %v", name, got, err)
+		}
+	}
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("JWKS() has %d keys, want 2", len(jwks.Keys))
+	}
+	if jwks.Keys[1].Kid != newKey.ID || jwks.Keys[1].Alg != "RS256" || jwks.Keys[1].N == "" {
+		t.Errorf("JWKS() rsa key = %+v", jwks.Keys[1])
+	}
+
+	keys.Remove(oldKID)
+	if _, err := ValidateJWT(oldToken, keys); err == nil {
+		t.Errorf("ValidateJWT() accepted a token signed by a removed key")
+	}
+}
+
+func TestNoSigningKey(t *testing.T) {
+	keys := newTestKeySet(t)
+	if err := keys.Retire(keys.JWKS().Keys[0].Kid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MakeJWT(uuid.New(), keys, time.Hour); err == nil {
+		t.Errorf("MakeJWT() signed with only retiring keys")
+	}
+}
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// roleRanks orders the roles from least to most privileged. Each role is
+// granted everything the roles before it are.
+var roleRanks = []Role{RoleUser, RoleModerator, RoleAdmin}
+
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if !slices.Contains(roleRanks, role) {
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+	return role, nil
+}
+
+// Includes reports whether r grants at least the privileges of other.
+// Unknown roles include nothing.
+func (r Role) Includes(other Role) bool {
+	rank := slices.Index(roleRanks, r)
+	return rank >= 0 && rank >= slices.Index(roleRanks, other)
+}
+
+func WithRole(role Role) ClaimOption {
+	return func(c *AccessClaims) {
+		c.Role = role
+	}
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRoleIncludes(t *testing.T) {
+	tests := []struct {
+		role  Role
+		other Role
+		want  bool
+	}{
+		{RoleAdmin, RoleAdmin, true},
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleUser, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleModerator, RoleUser, true},
+		{RoleUser, RoleModerator, false},
+		{Role(""), RoleUser, false},
+		{Role("root"), RoleUser, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Includes(tt.other); got != tt.want {
+			t.Errorf("%q.Includes(%q) = %v, want %v", tt.role, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	if role, err := ParseRole("moderator"); err != nil || role != RoleModerator {
+		t.Errorf("ParseRole(moderator) = %q, %v", role, err)
+	}
+	if _, err := ParseRole("root"); err == nil {
+		t.Errorf("ParseRole(root) accepted an unknown role")
+	}
+}
+
+func TestRoleClaim(t *testing.T) {
+	keys := newTestKeySet(t)
+
+	token, err := MakeJWT(uuid.New(), keys, time.Hour, WithRole(RoleAdmin))
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	claims, err := ParseJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	if claims.Role != RoleAdmin {
+		t.Errorf("Role = %q, want %q", claims.Role, RoleAdmin)
+	}
+}
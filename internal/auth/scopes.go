@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type Scope string
+
+const (
+	ScopeChirpsWrite  Scope = "chirps:write"
+	ScopeChirpsDelete Scope = "chirps:delete"
+	ScopeProfileWrite Scope = "profile:write"
+)
+
+var KnownScopes = []Scope{ScopeChirpsWrite, ScopeChirpsDelete, ScopeProfileWrite}
+
+// PersonalAccessTokenPrefix marks personal access tokens so the auth path can
+// tell them apart from JWTs without a database lookup.
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+// ParseScopes splits a space separated scope list, rejecting unknown scopes.
+func ParseScopes(s string) ([]Scope, error) {
+	scopes := []Scope{}
+	for _, field := range strings.Fields(s) {
+		scope := Scope(field)
+		if !slices.Contains(KnownScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", field)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+func FormatScopes(scopes []Scope) string {
+	fields := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		fields = append(fields, string(scope))
+	}
+	return strings.Join(fields, " ")
+}
+
+// WithClient marks the token as issued to an OAuth client and limits it to
+// scopes.
+func WithClient(clientID uuid.UUID, scopes []Scope) ClaimOption {
+	return func(c *AccessClaims) {
+		c.ClientID = clientID.String()
+		c.Scope = FormatScopes(scopes)
+	}
+}
+
+// Client returns the OAuth client a token was issued to and the scopes it
+// holds. ok is false for tokens that aren't limited to a client.
+func (c *AccessClaims) Client() (clientID uuid.UUID, scopes []Scope, ok bool) {
+	if c.ClientID == "" {
+		return uuid.Nil, nil, false
+	}
+	clientID, err := uuid.Parse(c.ClientID)
+	if err != nil {
+		return uuid.Nil, nil, false
+	}
+	for _, field := range strings.Fields(c.Scope) {
+		scopes = append(scopes, Scope(field))
+	}
+	return clientID, scopes, true
+}
+
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + token, nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
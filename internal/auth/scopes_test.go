@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "Empty", input: "", want: ""},
+		{name: "Known scopes", input: "chirps:write  profile:write", want: "chirps:write profile:write"},
+		{name: "Duplicates are dropped", input: "chirps:delete chirps:delete", want: "chirps:delete"},
+		{name: "Unknown scope", input: "chirps:write admin", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scopes, err := ParseScopes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := FormatScopes(scopes); !tt.wantErr && got != tt.want {
+				t.Errorf("ParseScopes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Errorf("IsPersonalAccessToken(%q) = false", token)
+	}
+
+	jwt, _ := MakeJWT(uuid.New(), newTestKeySet(t), time.Hour)
+	if IsPersonalAccessToken(jwt) {
+		t.Errorf("IsPersonalAccessToken() = true for a JWT")
+	}
+}
+
+func TestClientClaim(t *testing.T) {
+	keys := newTestKeySet(t)
+	clientID := uuid.New()
+
+	token, err := MakeJWT(uuid.New(), keys, time.Hour, WithClient(clientID, []Scope{ScopeChirpsWrite, ScopeProfileWrite}))
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	claims, err := ParseJWT(token, keys)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	gotClient, scopes, ok := claims.Client()
+	if !ok || gotClient != clientID || FormatScopes(scopes) != "chirps:write profile:write" {
+		t.Errorf("Client() = %s, %v, %v", gotClient, scopes, ok)
+	}
+
+	token, _ = MakeJWT(uuid.New(), keys, time.Hour)
+	claims, _ = ParseJWT(token, keys)
+	if _, _, ok := claims.Client(); ok {
+		t.Errorf("Client() ok for a token without a client")
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// encryptedSecretPrefix marks values written by EncryptSecret, so secrets
+// stored in plaintext before encryption was added can still be told apart.
+const encryptedSecretPrefix = "v1:"
+
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// DeriveKey derives a 256-bit key for one purpose from the server secret, so
+// the same secret never keys two different primitives.
+func DeriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("chirpy:" + purpose))
+	return mac.Sum(nil)
+}
+
+// EncryptSecret seals a secret the server needs to read back, such as a TOTP
+// seed, with AES-256-GCM.
+func EncryptSecret(plaintext string, key []byte) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("error generating nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedSecretPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret opens a value from EncryptSecret. Values without the prefix
+// predate encryption and are returned as they are.
+func DecryptSecret(ciphertext string, key []byte) (string, error) {
+	encoded, ok := strings.CutPrefix(ciphertext, encryptedSecretPrefix)
+	if !ok {
+		return ciphertext, nil
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", ErrInvalidCiphertext
+	}
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", ErrInvalidCiphertext
+	}
+	return string(plaintext), nil
+}
+
+// IsEncryptedSecret reports whether s was written by EncryptSecret.
+func IsEncryptedSecret(s string) bool {
+	return strings.HasPrefix(s, encryptedSecretPrefix)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	key := DeriveKey([]byte("server secret"), "totp")
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := EncryptSecret(secret, key)
+	if err != nil {
+		t.Fatalf("EncryptSecret() error = %v", err)
+	}
+	if !IsEncryptedSecret(ciphertext) || ciphertext == secret {
+		t.Fatalf("EncryptSecret() = %q, want an encrypted value", ciphertext)
+	}
+
+	again, _ := EncryptSecret(secret, key)
+	if again == ciphertext {
+		t.Errorf("EncryptSecret() reused a nonce")
+	}
+
+	got, err := DecryptSecret(ciphertext, key)
+	if err != nil || got != secret {
+		t.Errorf("DecryptSecret() = %q, %v, want %q", got, err, secret)
+	}
+}
+
+func TestDecryptSecretErrors(t *testing.T) {
+	key := DeriveKey([]byte("server secret"), "totp")
+	ciphertext, _ := EncryptSecret("JBSWY3DPEHPK3PXP", key)
+
+	tests := map[string]struct {
+		input string
+		key   []byte
+	}{
+		"wrong key":     {input: ciphertext, key: DeriveKey([]byte("other secret"), "totp")},
+		"wrong purpose": {input: ciphertext, key: DeriveKey([]byte("server secret"), "other")},
+		"tampered":      {input: ciphertext[:len(ciphertext)-2] + "AA", key: key},
+		"truncated":     {input: encryptedSecretPrefix + "AAAA", key: key},
+		"not base64":    {input: encryptedSecretPrefix + "!!!", key: key},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecryptSecret(tt.input, tt.key)
+			if !errors.Is(err, ErrInvalidCiphertext) {
+				t.Errorf("DecryptSecret() error = %v, want ErrInvalidCiphertext", err)
+			}
+		})
+	}
+}
+
+func TestDecryptSecretPlaintext(t *testing.T) {
+	got, err := DecryptSecret("JBSWY3DPEHPK3PXP", DeriveKey([]byte("server secret"), "totp"))
+	if err != nil || got != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("DecryptSecret() = %q, %v, want the plaintext back", got, err)
+	}
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 SHA1 test secret, truncated to six digits.
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		name     string
+		code     string
+		now      time.Time
+		wantStep int64
+		wantErr  bool
+	}{
+		{
+			name:     "RFC vector 59",
+			code:     "287082",
+			now:      time.Unix(59, 0),
+			wantStep: 1,
+		},
+		{
+			name:     "RFC vector 1111111109",
+			code:     "081804",
+			now:      time.Unix(1111111109, 0),
+			wantStep: 37037036,
+		},
+		{
+			name:     "Previous period is accepted",
+			code:     "081804",
+			now:      time.Unix(1111111109+totpPeriod, 0),
+			wantStep: 37037036,
+		},
+		{
+			name:    "Outside skew",
+			code:    "081804",
+			now:     time.Unix(1111111109+3*totpPeriod, 0),
+			wantErr: true,
+		},
+		{
+			name:    "Wrong length",
+			code:    "81804",
+			now:     time.Unix(1111111109, 0),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, err := ValidateTOTP(secret, tt.code, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateTOTP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && step != tt.wantStep {
+				t.Errorf("ValidateTOTP() step = %d, want %d", step, tt.wantStep)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		normalized := NormalizeRecoveryCode(code)
+		if len(normalized) != 16 || seen[normalized] {
+			t.Errorf("bad recovery code %q", code)
+		}
+		seen[normalized] = true
+		if NormalizeRecoveryCode(" "+code+" ") != normalized {
+			t.Errorf("NormalizeRecoveryCode() isn't stable for %q", code)
+		}
+	}
+}
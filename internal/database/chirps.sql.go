@@ -7,10 +7,22 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const countChirpsByUserID = `-- name: CountChirpsByUserID :one
+select count(*) from chirps where user_id = $1
+`
+
+func (q *Queries) CountChirpsByUserID(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsByUserID, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
 insert into chirps (id, created_at, updated_at, body, user_id)
 values (
@@ -50,13 +62,31 @@ func (q *Queries) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
-const getAllChirpsAsc = `-- name: GetAllChirpsAsc :many
-select id, created_at, updated_at, body, user_id from chirps 
+const getChirpByID = `-- name: GetChirpByID :one
+select id, created_at, updated_at, body, user_id from chirps where id = $1
+`
+
+func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByID, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+	)
+	return i, err
+}
+
+const getChirpsByUserIDAsc = `-- name: GetChirpsByUserIDAsc :many
+select id, created_at, updated_at, body, user_id from chirps
+where user_id = $1
 order by created_at asc
 `
 
-func (q *Queries) GetAllChirpsAsc(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirpsAsc)
+func (q *Queries) GetChirpsByUserIDAsc(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUserIDAsc, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -84,13 +114,14 @@ func (q *Queries) GetAllChirpsAsc(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getAllChirpsDesc = `-- name: GetAllChirpsDesc :many
-select id, created_at, updated_at, body, user_id from chirps 
+const getChirpsByUserIDDesc = `-- name: GetChirpsByUserIDDesc :many
+select id, created_at, updated_at, body, user_id from chirps
+where user_id = $1
 order by created_at desc
 `
 
-func (q *Queries) GetAllChirpsDesc(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirpsDesc)
+func (q *Queries) GetChirpsByUserIDDesc(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUserIDDesc, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -118,31 +149,29 @@ func (q *Queries) GetAllChirpsDesc(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const getChirpByID = `-- name: GetChirpByID :one
-select id, created_at, updated_at, body, user_id from chirps where id = $1
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+select id, created_at, updated_at, body, user_id from chirps
+where ($1::uuid is null or user_id = $1::uuid)
+and ($2::timestamp is null
+    or (created_at, id) > ($2::timestamp, $3::uuid))
+order by created_at asc, id asc
+limit $4
 `
 
-func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirpByID, id)
-	var i Chirp
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Body,
-		&i.UserID,
-	)
-	return i, err
+type ListChirpsAscParams struct {
+	UserID         uuid.NullUUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	MaxChirps      int32
 }
 
-const getChirpsByUserIDAsc = `-- name: GetChirpsByUserIDAsc :many
-select id, created_at, updated_at, body, user_id from chirps
-where user_id = $1
-order by created_at asc
-`
-
-func (q *Queries) GetChirpsByUserIDAsc(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByUserIDAsc, userID)
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.UserID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.MaxChirps,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -170,14 +199,29 @@ func (q *Queries) GetChirpsByUserIDAsc(ctx context.Context, userID uuid.UUID) ([
 	return items, nil
 }
 
-const getChirpsByUserIDDesc = `-- name: GetChirpsByUserIDDesc :many
+const listChirpsDesc = `-- name: ListChirpsDesc :many
 select id, created_at, updated_at, body, user_id from chirps
-where user_id = $1
-order by created_at desc
+where ($1::uuid is null or user_id = $1::uuid)
+and ($2::timestamp is null
+    or (created_at, id) < ($2::timestamp, $3::uuid))
+order by created_at desc, id desc
+limit $4
 `
 
-func (q *Queries) GetChirpsByUserIDDesc(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByUserIDDesc, userID)
+type ListChirpsDescParams struct {
+	UserID         uuid.NullUUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+	MaxChirps      int32
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.UserID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.MaxChirps,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -6,11 +6,23 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type AuditLog struct {
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	Action          string
+	ActorID         uuid.UUID
+	UserID          uuid.UUID
+	ImpersonationID uuid.NullUUID
+	Request         sql.NullString
+	Status          sql.NullInt32
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
@@ -19,20 +31,204 @@ type Chirp struct {
 	UserID    uuid.UUID
 }
 
-type RefreshToken struct {
-	Token     string
+type DataExport struct {
+	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	Format    string
+	Status    string
+	Archive   []byte
+	Error     sql.NullString
+	UserID    uuid.UUID
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	Email     string
+	UserID    uuid.UUID
+}
+
+type Impersonation struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	EndedAt   sql.NullTime
+	Reason    string
+	AdminID   uuid.UUID
+	UserID    uuid.UUID
+}
+
+type LoginAttempt struct {
+	Kind          string
+	Subject       string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type MagicLinkRequest struct {
+	Email       string
+	RequestedAt time.Time
+}
+
+type MagicLinkToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
 	UserID    uuid.UUID
 }
 
+type MfaRecoveryCode struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+	CodeHash  string
+	UserID    uuid.UUID
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+	RedirectUri   string
+	Scopes        string
+	CodeChallenge string
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris string
+	Scopes       string
+	RevokedAt    sql.NullTime
+	CreatedBy    uuid.NullUUID
+}
+
+type OidcLoginState struct {
+	StateHash    string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	UserID    uuid.UUID
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Name       string
+	TokenHash  string
+	Scopes     string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+	UserID     uuid.UUID
+}
+
+type RefreshToken struct {
+	TokenHash  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	UserID     uuid.UUID
+	FamilyID   uuid.UUID
+	ReplacedBy sql.NullString
+}
+
+type Session struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	UserAgent  string
+	IpAddress  string
+	UserID     uuid.UUID
+	ClientID   uuid.NullUUID
+	Scopes     sql.NullString
+}
+
+type Subscription struct {
+	ID                 uuid.UUID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	Plan               string
+	Status             string
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+	CanceledAt         sql.NullTime
+	UserID             uuid.UUID
+	LastEventID        sql.NullString
+}
+
+type UsedMfaToken struct {
+	TokenID   uuid.UUID
+	ExpiresAt time.Time
+}
+
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Email               string
+	HashedPassword      string
+	TotpSecret          sql.NullString
+	TotpEnabledAt       sql.NullTime
+	TotpLastStep        int64
+	EmailVerifiedAt     sql.NullTime
+	PendingEmail        sql.NullString
+	Role                string
+	TokenVersion        int32
+	SuspendedAt         sql.NullTime
+	DeletionScheduledAt sql.NullTime
+}
+
+type UserIdentity struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Provider  string
+	Subject   string
+	Email     string
+	UserID    uuid.UUID
+}
+
+type WebhookEvent struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	EventID     string
+	EventType   string
+	Payload     json.RawMessage
+	Status      string
+	Error       sql.NullString
+	Attempts    int32
+	ProcessedAt sql.NullTime
+}
+
+type WebhookSignature struct {
+	ReplayKey string
+	ExpiresAt time.Time
 }
@@ -7,53 +7,83 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 const createToken = `-- name: CreateToken :one
-insert into refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+insert into refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, family_id)
 values (
     $1, 
     now(),
     now(),
     $2, 
-    $3
+    $3,
+    $4
 )
-returning token, created_at, updated_at, expires_at, revoked_at, user_id
+returning token_hash, created_at, updated_at, expires_at, revoked_at, user_id, family_id, replaced_by
 `
 
 type CreateTokenParams struct {
-	Token     string
+	TokenHash string
 	UserID    uuid.UUID
 	ExpiresAt time.Time
+	FamilyID  uuid.UUID
 }
 
 func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, createToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.FamilyID,
+	)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.UserID,
+		&i.FamilyID,
+		&i.ReplacedBy,
+	)
+	return i, err
+}
+
+const getRefreshToken = `-- name: GetRefreshToken :one
+select token_hash, created_at, updated_at, expires_at, revoked_at, user_id, family_id, replaced_by from refresh_tokens where token_hash = $1
+`
+
+func (q *Queries) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, tokenHash)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ExpiresAt,
 		&i.RevokedAt,
 		&i.UserID,
+		&i.FamilyID,
+		&i.ReplacedBy,
 	)
 	return i, err
 }
 
 const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.is_chirpy_red FROM users
+SELECT users.id, users.created_at, users.updated_at, users.email, users.hashed_password, users.totp_secret, users.totp_enabled_at, users.totp_last_step, users.email_verified_at, users.pending_email, users.role, users.token_version, users.suspended_at, users.deletion_scheduled_at FROM users
 JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
+WHERE refresh_tokens.token_hash = $1
 AND revoked_at IS NULL
 AND expires_at > NOW()
 `
 
-func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, token)
+func (q *Queries) GetUserFromRefreshToken(ctx context.Context, tokenHash string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserFromRefreshToken, tokenHash)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -61,28 +91,125 @@ func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (Us
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.TokenVersion,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
 
+const revokeAllRefreshTokens = `-- name: RevokeAllRefreshTokens :exec
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeAllRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokens, userID)
+	return err
+}
+
+const revokeClientRefreshTokens = `-- name: RevokeClientRefreshTokens :exec
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE family_id IN (SELECT id FROM sessions WHERE client_id = $1)
+AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeClientRefreshTokens(ctx context.Context, clientID uuid.NullUUID) error {
+	_, err := q.db.ExecContext(ctx, revokeClientRefreshTokens, clientID)
+	return err
+}
+
+const revokeOtherRefreshTokens = `-- name: RevokeOtherRefreshTokens :exec
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE user_id = $1
+AND family_id <> $2
+AND revoked_at IS NULL
+`
+
+type RevokeOtherRefreshTokensParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeOtherRefreshTokens(ctx context.Context, arg RevokeOtherRefreshTokensParams) error {
+	_, err := q.db.ExecContext(ctx, revokeOtherRefreshTokens, arg.UserID, arg.FamilyID)
+	return err
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :one
 UPDATE refresh_tokens SET revoked_at = NOW(),
 updated_at = NOW()
-WHERE token = $1
-RETURNING token, created_at, updated_at, expires_at, revoked_at, user_id
+WHERE token_hash = $1
+RETURNING token_hash, created_at, updated_at, expires_at, revoked_at, user_id, family_id, replaced_by
+`
+
+func (q *Queries) RevokeRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, revokeRefreshToken, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.UserID,
+		&i.FamilyID,
+		&i.ReplacedBy,
+	)
+	return i, err
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE family_id = $1
+AND revoked_at IS NULL
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, revokeRefreshToken, token)
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :one
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW(),
+replaced_by = $2
+WHERE token_hash = $1
+AND revoked_at IS NULL
+RETURNING token_hash, created_at, updated_at, expires_at, revoked_at, user_id, family_id, replaced_by
+`
+
+type RotateRefreshTokenParams struct {
+	TokenHash  string
+	ReplacedBy sql.NullString
+}
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, rotateRefreshToken, arg.TokenHash, arg.ReplacedBy)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ExpiresAt,
 		&i.RevokedAt,
 		&i.UserID,
+		&i.FamilyID,
+		&i.ReplacedBy,
 	)
 	return i, err
 }
@@ -7,10 +7,162 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const applyPendingEmail = `-- name: ApplyPendingEmail :one
+update users set email = pending_email,
+pending_email = null,
+email_verified_at = now(),
+updated_at = now()
+where id = $1
+and pending_email = $2::text
+returning id, created_at, updated_at, email, hashed_password, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, token_version, suspended_at, deletion_scheduled_at
+`
+
+type ApplyPendingEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) ApplyPendingEmail(ctx context.Context, arg ApplyPendingEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, applyPendingEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.TokenVersion,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const bumpClientUsersTokenVersions = `-- name: BumpClientUsersTokenVersions :many
+update users set token_version = token_version + 1, updated_at = now()
+where id in (
+    select user_id from sessions
+    where client_id = $1
+    and revoked_at is null
+)
+returning id, token_version
+`
+
+type BumpClientUsersTokenVersionsRow struct {
+	ID           uuid.UUID
+	TokenVersion int32
+}
+
+func (q *Queries) BumpClientUsersTokenVersions(ctx context.Context, clientID uuid.NullUUID) ([]BumpClientUsersTokenVersionsRow, error) {
+	rows, err := q.db.QueryContext(ctx, bumpClientUsersTokenVersions, clientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []BumpClientUsersTokenVersionsRow
+	for rows.Next() {
+		var i BumpClientUsersTokenVersionsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.TokenVersion,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const bumpTokenVersion = `-- name: BumpTokenVersion :one
+update users set token_version = token_version + 1, updated_at = now()
+where id = $1
+returning token_version
+`
+
+func (q *Queries) BumpTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, bumpTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
+const cancelUserDeletion = `-- name: CancelUserDeletion :exec
+update users set deletion_scheduled_at = null, updated_at = now()
+where id = $1
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	return err
+}
+
+const countUsersByPasswordParams = `-- name: CountUsersByPasswordParams :many
+select split_part(hashed_password, '$', 4)::text as params, count(*) as users
+from users
+where hashed_password like '$argon2id$%'
+group by 1
+order by 2 desc
+`
+
+type CountUsersByPasswordParamsRow struct {
+	Params string
+	Users  int64
+}
+
+func (q *Queries) CountUsersByPasswordParams(ctx context.Context) ([]CountUsersByPasswordParamsRow, error) {
+	rows, err := q.db.QueryContext(ctx, countUsersByPasswordParams)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountUsersByPasswordParamsRow
+	for rows.Next() {
+		var i CountUsersByPasswordParamsRow
+		if err := rows.Scan(
+			&i.Params,
+			&i.Users,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countUsersByRole = `-- name: CountUsersByRole :one
+select count(*) from users where role = $1
+`
+
+func (q *Queries) CountUsersByRole(ctx context.Context, role string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsersByRole, role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 insert into users (id, created_at, updated_at, email, hashed_password)
 values (
@@ -20,7 +172,7 @@ values (
     $1,
     $2
 )
-returning id, created_at, updated_at, email, hashed_password, is_chirpy_red
+returning id, created_at, updated_at, email, hashed_password, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, token_version, suspended_at, deletion_scheduled_at
 `
 
 type CreateUserParams struct {
@@ -37,11 +189,72 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.TokenVersion,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
 
+const createUserWithoutPassword = `-- name: CreateUserWithoutPassword :one
+insert into users (id, created_at, updated_at, email, email_verified_at)
+values (
+    gen_random_uuid(),
+    now(),
+    now(),
+    $1,
+    $2
+)
+returning id, created_at, updated_at, email, hashed_password, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, token_version, suspended_at, deletion_scheduled_at
+`
+
+type CreateUserWithoutPasswordParams struct {
+	Email           string
+	EmailVerifiedAt sql.NullTime
+}
+
+func (q *Queries) CreateUserWithoutPassword(ctx context.Context, arg CreateUserWithoutPasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, createUserWithoutPassword, arg.Email, arg.EmailVerifiedAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.TokenVersion,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const deleteScheduledUsers = `-- name: DeleteScheduledUsers :execrows
+delete from users
+where deletion_scheduled_at is not null
+and deletion_scheduled_at <= now()
+`
+
+func (q *Queries) DeleteScheduledUsers(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteScheduledUsers)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteUsers = `-- name: DeleteUsers :exec
 delete from users
 `
@@ -51,8 +264,49 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 	return err
 }
 
+const disableTOTP = `-- name: DisableTOTP :exec
+update users set totp_secret = null, totp_enabled_at = null, totp_last_step = 0, updated_at = now()
+where id = $1
+`
+
+func (q *Queries) DisableTOTP(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, disableTOTP, id)
+	return err
+}
+
+const enableTOTP = `-- name: EnableTOTP :exec
+update users set totp_enabled_at = now(), totp_last_step = $1, updated_at = now()
+where id = $2
+`
+
+type EnableTOTPParams struct {
+	TotpLastStep int64
+	ID           uuid.UUID
+}
+
+func (q *Queries) EnableTOTP(ctx context.Context, arg EnableTOTPParams) error {
+	_, err := q.db.ExecContext(ctx, enableTOTP, arg.TotpLastStep, arg.ID)
+	return err
+}
+
+const encryptTOTPSecret = `-- name: EncryptTOTPSecret :exec
+update users set totp_secret = $1
+where id = $2
+and totp_secret not like 'v1:%'
+`
+
+type EncryptTOTPSecretParams struct {
+	TotpSecret sql.NullString
+	ID         uuid.UUID
+}
+
+func (q *Queries) EncryptTOTPSecret(ctx context.Context, arg EncryptTOTPSecretParams) error {
+	_, err := q.db.ExecContext(ctx, encryptTOTPSecret, arg.TotpSecret, arg.ID)
+	return err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-select id, created_at, updated_at, email, hashed_password, is_chirpy_red from users where email = $1
+select id, created_at, updated_at, email, hashed_password, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, token_version, suspended_at, deletion_scheduled_at from users where email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -64,25 +318,205 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.TokenVersion,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
 
-const updateUserEmailAndPasswordByUserID = `-- name: UpdateUserEmailAndPasswordByUserID :one
-update users set email = $1, hashed_password = $2, updated_at = now()
-where id = $3
-returning id, created_at, updated_at, email, hashed_password, is_chirpy_red
+const getUserByID = `-- name: GetUserByID :one
+select id, created_at, updated_at, email, hashed_password, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, token_version, suspended_at, deletion_scheduled_at from users where id = $1
 `
 
-type UpdateUserEmailAndPasswordByUserIDParams struct {
-	Email          string
-	HashedPassword string
-	ID             uuid.UUID
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.TokenVersion,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const getUserTokenVersion = `-- name: GetUserTokenVersion :one
+select token_version from users where id = $1
+`
+
+func (q *Queries) GetUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, getUserTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
 }
 
-func (q *Queries) UpdateUserEmailAndPasswordByUserID(ctx context.Context, arg UpdateUserEmailAndPasswordByUserIDParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUserEmailAndPasswordByUserID, arg.Email, arg.HashedPassword, arg.ID)
+const listPlaintextTOTPSecrets = `-- name: ListPlaintextTOTPSecrets :many
+select id, totp_secret from users
+where totp_secret is not null
+and totp_secret not like 'v1:%'
+`
+
+type ListPlaintextTOTPSecretsRow struct {
+	ID         uuid.UUID
+	TotpSecret sql.NullString
+}
+
+func (q *Queries) ListPlaintextTOTPSecrets(ctx context.Context) ([]ListPlaintextTOTPSecretsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listPlaintextTOTPSecrets)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPlaintextTOTPSecretsRow
+	for rows.Next() {
+		var i ListPlaintextTOTPSecretsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.TotpSecret,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :one
+update users set email_verified_at = now(), updated_at = now()
+where id = $1
+and email = $2
+returning id, created_at, updated_at, email, hashed_password, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, token_version, suspended_at, deletion_scheduled_at
+`
+
+type MarkEmailVerifiedParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) MarkEmailVerified(ctx context.Context, arg MarkEmailVerifiedParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, markEmailVerified, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.TokenVersion,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :exec
+update users set hashed_password = $1
+where id = $2
+and hashed_password = $3
+`
+
+type RehashUserPasswordParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, rehashUserPassword, arg.NewHash, arg.ID, arg.OldHash)
+	return err
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+update users set deletion_scheduled_at = $1, token_version = token_version + 1, updated_at = now()
+where id = $2
+returning id, created_at, updated_at, email, hashed_password, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, token_version, suspended_at, deletion_scheduled_at
+`
+
+type ScheduleUserDeletionParams struct {
+	DeletionScheduledAt sql.NullTime
+	ID                  uuid.UUID
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.DeletionScheduledAt, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.TokenVersion,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const setPendingTOTPSecret = `-- name: SetPendingTOTPSecret :exec
+update users set totp_secret = $1, totp_enabled_at = null, updated_at = now()
+where id = $2
+`
+
+type SetPendingTOTPSecretParams struct {
+	TotpSecret sql.NullString
+	ID         uuid.UUID
+}
+
+func (q *Queries) SetPendingTOTPSecret(ctx context.Context, arg SetPendingTOTPSecretParams) error {
+	_, err := q.db.ExecContext(ctx, setPendingTOTPSecret, arg.TotpSecret, arg.ID)
+	return err
+}
+
+const setUserRole = `-- name: SetUserRole :one
+update users set role = $1, token_version = token_version + 1, updated_at = now()
+where id = $2
+returning id, created_at, updated_at, email, hashed_password, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, token_version, suspended_at, deletion_scheduled_at
+`
+
+type SetUserRoleParams struct {
+	Role string
+	ID   uuid.UUID
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserRole, arg.Role, arg.ID)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -90,17 +524,142 @@ func (q *Queries) UpdateUserEmailAndPasswordByUserID(ctx context.Context, arg Up
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
-		&i.IsChirpyRed,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.TokenVersion,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
 	)
 	return i, err
 }
 
-const upgradesToChirpyRedViaID = `-- name: UpgradesToChirpyRedViaID :exec
-update users set is_chirpy_red = true, updated_at = now()
+const suspendUser = `-- name: SuspendUser :one
+update users set suspended_at = now(), token_version = token_version + 1, updated_at = now()
 where id = $1
+returning id, created_at, updated_at, email, hashed_password, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, token_version, suspended_at, deletion_scheduled_at
 `
 
-func (q *Queries) UpgradesToChirpyRedViaID(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, upgradesToChirpyRedViaID, id)
+func (q *Queries) SuspendUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, suspendUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.TokenVersion,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const unsuspendUser = `-- name: UnsuspendUser :one
+update users set suspended_at = null, updated_at = now()
+where id = $1
+returning id, created_at, updated_at, email, hashed_password, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, token_version, suspended_at, deletion_scheduled_at
+`
+
+func (q *Queries) UnsuspendUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, unsuspendUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.TokenVersion,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+update users set hashed_password = $1, token_version = token_version + 1, updated_at = now()
+where id = $2
+`
+
+type UpdateUserPasswordParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.HashedPassword, arg.ID)
 	return err
 }
+
+const updateUserPasswordAndPendingEmailByUserID = `-- name: UpdateUserPasswordAndPendingEmailByUserID :one
+update users set hashed_password = coalesce($1::text, hashed_password),
+pending_email = coalesce($2, pending_email),
+token_version = token_version + (case when $1::text is null then 0 else 1 end),
+updated_at = now()
+where id = $3
+returning id, created_at, updated_at, email, hashed_password, totp_secret, totp_enabled_at, totp_last_step, email_verified_at, pending_email, role, token_version, suspended_at, deletion_scheduled_at
+`
+
+type UpdateUserPasswordAndPendingEmailByUserIDParams struct {
+	HashedPassword sql.NullString
+	PendingEmail   sql.NullString
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUserPasswordAndPendingEmailByUserID(ctx context.Context, arg UpdateUserPasswordAndPendingEmailByUserIDParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserPasswordAndPendingEmailByUserID, arg.HashedPassword, arg.PendingEmail, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+		&i.EmailVerifiedAt,
+		&i.PendingEmail,
+		&i.Role,
+		&i.TokenVersion,
+		&i.SuspendedAt,
+		&i.DeletionScheduledAt,
+	)
+	return i, err
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+update users set totp_last_step = $1
+where id = $2
+and totp_last_step < $1
+`
+
+type UseTOTPStepParams struct {
+	TotpLastStep int64
+	ID           uuid.UUID
+}
+
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.TotpLastStep, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
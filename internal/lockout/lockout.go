@@ -0,0 +1,43 @@
+package lockout
+
+import (
+	"math"
+	"time"
+)
+
+type Kind string
+
+const (
+	KindAccount Kind = "account"
+	KindIP      Kind = "ip"
+)
+
+// Policy decides how long a subject is locked out after a run of failures.
+// The first Threshold-1 failures are free; from then on the lockout starts
+// at Base and doubles with every further failure up to Max.
+type Policy struct {
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+}
+
+func (p Policy) Backoff(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+	exp := failures - p.Threshold
+	if exp > 30 {
+		return p.Max
+	}
+	d := p.Base * time.Duration(math.Pow(2, float64(exp)))
+	if d > p.Max || d <= 0 {
+		return p.Max
+	}
+	return d
+}
+
+// RetryAfter rounds the remaining lockout up to whole seconds for the
+// Retry-After header.
+func RetryAfter(lockedUntil, now time.Time) int {
+	return int(math.Ceil(lockedUntil.Sub(now).Seconds()))
+}
@@ -0,0 +1,36 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := Policy{Threshold: 5, Base: 30 * time.Second, Max: time.Hour}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 4, want: 0},
+		{failures: 5, want: 30 * time.Second},
+		{failures: 6, want: time.Minute},
+		{failures: 8, want: 4 * time.Minute},
+		{failures: 12, want: time.Hour},
+		{failures: 1000, want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := p.Backoff(tt.failures); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Now()
+	if got := RetryAfter(now.Add(1500*time.Millisecond), now); got != 2 {
+		t.Errorf("RetryAfter() = %d, want 2", got)
+	}
+}
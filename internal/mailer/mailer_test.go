@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := &FileMailer{Dir: dir, From: "chirpy@example.com"}
+
+	err := m.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Reset your password",
+		Body:    "line one\nline two",
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("found %d messages, want 1 (%v)", len(files), err)
+	}
+	dat, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"To: user@example.com\r\n", "Subject: Reset your password\r\n", "\r\n\r\nline one\r\nline two"} {
+		if !strings.Contains(string(dat), want) {
+			t.Errorf("message is missing %q:\n%s", want, dat)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubIdP is a minimal OpenID provider that hands out an ID token for the
+// code "good-code" when the PKCE verifier matches the expected challenge.
+type stubIdP struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "stub",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good-code" || S256Challenge(r.Form.Get("code_verifier")) != idp.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    idp.server.URL,
+				Subject:   "user-123",
+				Audience:  jwt.ClaimStrings{"chirpy"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			Nonce:         idp.nonce,
+			Email:         "user@example.com",
+			EmailVerified: true,
+		})
+		token.Header["kid"] = "stub"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp := newStubIdP(t)
+	provider := &Provider{
+		Name:        "stub",
+		Issuer:      idp.server.URL,
+		ClientID:    "chirpy",
+		RedirectURL: "http://localhost:8080/api/oauth/stub/callback",
+	}
+	ctx := context.Background()
+
+	verifier, _ := RandomString()
+	nonce, _ := RandomString()
+	idp.challenge = S256Challenge(verifier)
+	idp.nonce = nonce
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", nonce, S256Challenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	if query.Get("code_challenge") != idp.challenge || query.Get("code_challenge_method") != "S256" || query.Get("state") != "state-1" {
+		t.Errorf("AuthCodeURL() = %s", authURL)
+	}
+
+	claims, err := provider.Exchange(ctx, "good-code", verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if claims.Subject != "user-123" || claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Errorf("Exchange() claims = %+v", claims)
+	}
+
+	if _, err := provider.Exchange(ctx, "good-code", "wrong-verifier", nonce); err == nil {
+		t.Errorf("Exchange() accepted a wrong PKCE verifier")
+	}
+	if _, err := provider.Exchange(ctx, "good-code", verifier, "other-nonce"); err == nil {
+		t.Errorf("Exchange() accepted a nonce mismatch")
+	}
+
+	provider.ClientID = "someone-else"
+	if _, err := provider.Exchange(ctx, "good-code", verifier, nonce); err == nil {
+		t.Errorf("Exchange() accepted a token for another audience")
+	}
+}
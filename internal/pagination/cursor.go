@@ -0,0 +1,48 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks a position in a list ordered by creation time, with the ID
+// breaking ties. Clients get it as an opaque string and hand it back to
+// fetch the page that follows.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// Encode returns the cursor as a URL-safe string. Timestamps are kept to the
+// microsecond, which is all Postgres stores.
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixMicro(), 10) + ":" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func Decode(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	micros, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	parsedID, err := uuid.Parse(id)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{CreatedAt: time.UnixMicro(n).UTC(), ID: parsedID}, nil
+}
@@ -0,0 +1,63 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := Cursor{
+		CreatedAt: time.Date(2024, 3, 9, 14, 30, 1, 123456000, time.UTC),
+		ID:        uuid.New(),
+	}
+
+	got, err := Decode(c.Encode())
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !got.CreatedAt.Equal(c.CreatedAt) || got.ID != c.ID {
+		t.Errorf("Decode() = %+v, want %+v", got, c)
+	}
+}
+
+func TestCursorTruncatesToMicroseconds(t *testing.T) {
+	c := Cursor{
+		CreatedAt: time.Date(2024, 3, 9, 14, 30, 1, 123456789, time.UTC),
+		ID:        uuid.New(),
+	}
+
+	got, err := Decode(c.Encode())
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	want := c.CreatedAt.Truncate(time.Microsecond)
+	if !got.CreatedAt.Equal(want) {
+		t.Errorf("CreatedAt = %v, want %v", got.CreatedAt, want)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := map[string]string{
+		"empty":         "",
+		"not base64":    "not a cursor!",
+		"no separator":  encode("1710000000000000"),
+		"bad timestamp": encode("yesterday:" + uuid.NewString()),
+		"bad id":        encode("1710000000000000:not-a-uuid"),
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Decode(input)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("Decode(%q) error = %v, want ErrInvalidCursor", input, err)
+			}
+		})
+	}
+}
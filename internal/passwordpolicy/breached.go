@@ -0,0 +1,86 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const prefixLength = 5
+
+// BreachedList holds SHA-1 hashes of breached passwords bucketed by their
+// first five hex characters, the same k-anonymity split the Pwned Passwords
+// range API uses, so only one small bucket is searched per lookup.
+type BreachedList struct {
+	ranges map[string]map[string]struct{}
+	size   int
+}
+
+// LoadBreachedList reads a file with one uppercase or lowercase SHA-1 hash
+// per line, optionally followed by ":count" as in the Pwned Passwords
+// downloads. Blank lines and lines starting with # are skipped.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening breached password list: %w", err)
+	}
+	defer f.Close()
+
+	list, err := ParseBreachedList(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return list, nil
+}
+
+func ParseBreachedList(r io.Reader) (*BreachedList, error) {
+	list := &BreachedList{ranges: map[string]map[string]struct{}{}}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) != 2*sha1.Size {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hash", lineNumber)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hash", lineNumber)
+		}
+
+		prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+		bucket, ok := list.ranges[prefix]
+		if !ok {
+			bucket = map[string]struct{}{}
+			list.ranges[prefix] = bucket
+		}
+		if _, ok := bucket[suffix]; !ok {
+			bucket[suffix] = struct{}{}
+			list.size++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (b *BreachedList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	_, ok := b.ranges[hash[:prefixLength]][hash[prefixLength:]]
+	return ok
+}
+
+func (b *BreachedList) Len() int {
+	return b.size
+}
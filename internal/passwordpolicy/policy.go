@@ -0,0 +1,83 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	CodeTooShort     = "too_short"
+	CodeTooLong      = "too_long"
+	CodeMatchesEmail = "matches_email"
+	CodeBreached     = "breached"
+)
+
+// Violation is one reason a password was rejected. Code is stable for
+// clients to switch on; Message can be shown to the user as is.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// Breached is optional; without it passwords aren't checked against
+	// known breaches.
+	Breached *BreachedList
+}
+
+// Validate returns every rule password breaks, or nil if it is acceptable.
+// Lengths are counted in characters. emails are the addresses of the
+// account, none of which may be used as the password.
+func (p Policy) Validate(password string, emails ...string) []Violation {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooShort,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, Violation{
+			Code:    CodeTooLong,
+			Message: fmt.Sprintf("Password must be at most %d characters long", p.MaxLength),
+		})
+	}
+
+	for _, email := range emails {
+		if matchesEmail(password, email) {
+			violations = append(violations, Violation{
+				Code:    CodeMatchesEmail,
+				Message: "Password can't be your email address",
+			})
+			break
+		}
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, Violation{
+			Code:    CodeBreached,
+			Message: "Password has appeared in a data breach, choose a different one",
+		})
+	}
+
+	return violations
+}
+
+// matchesEmail catches the address itself and its local part, ignoring case.
+func matchesEmail(password, email string) bool {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return false
+	}
+	password = strings.TrimSpace(password)
+	if strings.EqualFold(password, email) {
+		return true
+	}
+	local, _, found := strings.Cut(email, "@")
+	return found && strings.EqualFold(password, local)
+}
@@ -0,0 +1,71 @@
+package passwordpolicy
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// SHA-1 of "password123" and "letmein".
+const testBreachedList = `# test list
+CBFDAC6008F9CAB4083784CBD1874F76618D2A97:2437452
+b7a875fc1ea228b9061041b7cec4bd3c52ab3ce3
+
+`
+
+func codes(violations []Violation) []string {
+	out := []string{}
+	for _, v := range violations {
+		out = append(out, v.Code)
+	}
+	return out
+}
+
+func TestValidate(t *testing.T) {
+	breached, err := ParseBreachedList(strings.NewReader(testBreachedList))
+	if err != nil {
+		t.Fatalf("ParseBreachedList() error = %v", err)
+	}
+	policy := Policy{MinLength: 8, MaxLength: 64, Breached: breached}
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		want     []string
+	}{
+		{name: "Acceptable", password: "correct horse battery", email: "walt@example.com", want: []string{}},
+		{name: "Empty", password: "", email: "walt@example.com", want: []string{CodeTooShort}},
+		{name: "Counts characters not bytes", password: "ééééééé", email: "", want: []string{CodeTooShort}},
+		{name: "Too long", password: strings.Repeat("a", 65), email: "", want: []string{CodeTooLong}},
+		{name: "Email", password: "Walt@Example.com", email: "walt@example.com", want: []string{CodeMatchesEmail}},
+		{name: "Email local part", password: "heisenberg", email: "Heisenberg@example.com", want: []string{CodeMatchesEmail}},
+		{name: "Breached", password: "password123", email: "", want: []string{CodeBreached}},
+		{name: "Several rules", password: "letmein", email: "letmein@example.com", want: []string{CodeTooShort, CodeMatchesEmail, CodeBreached}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := codes(policy.Validate(tt.password, tt.email))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBreachedList(t *testing.T) {
+	list, err := ParseBreachedList(strings.NewReader(testBreachedList))
+	if err != nil {
+		t.Fatalf("ParseBreachedList() error = %v", err)
+	}
+	if list.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", list.Len())
+	}
+	if list.Contains("password1234") {
+		t.Errorf("Contains() matched a password that isn't listed")
+	}
+
+	if _, err := ParseBreachedList(strings.NewReader("not-a-hash\n")); err == nil {
+		t.Errorf("ParseBreachedList() accepted an invalid line")
+	}
+}
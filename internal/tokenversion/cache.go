@@ -0,0 +1,94 @@
+package tokenversion
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LookupFunc func(ctx context.Context, userID uuid.UUID) (int32, error)
+
+// Cache remembers users' current token versions for a short while so that
+// checking an access token doesn't hit the database on every request.
+// Versions bumped by this process are stored with Set right away; bumps made
+// by other instances are picked up once the entry expires.
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+	lookup     LookupFunc
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[uuid.UUID]entry
+}
+
+type entry struct {
+	version   int32
+	expiresAt time.Time
+}
+
+func New(ttl time.Duration, maxEntries int, lookup LookupFunc) *Cache {
+	return &Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		lookup:     lookup,
+		now:        time.Now,
+		entries:    map[uuid.UUID]entry{},
+	}
+}
+
+// Get returns the user's current token version, looking it up when it isn't
+// cached. Lookup errors are returned as is and not cached.
+func (c *Cache) Get(ctx context.Context, userID uuid.UUID) (int32, error) {
+	c.mu.Lock()
+	e, ok := c.entries[userID]
+	c.mu.Unlock()
+	if ok && c.now().Before(e.expiresAt) {
+		return e.version, nil
+	}
+
+	version, err := c.lookup(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	c.Set(userID, version)
+	return version, nil
+}
+
+func (c *Cache) Set(userID uuid.UUID, version int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[userID]; !ok && len(c.entries) >= c.maxEntries {
+		c.evict()
+	}
+	c.entries[userID] = entry{
+		version:   version,
+		expiresAt: c.now().Add(c.ttl),
+	}
+}
+
+func (c *Cache) Forget(userID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, userID)
+}
+
+// evict drops expired entries, and if that frees nothing, an arbitrary one.
+func (c *Cache) evict() {
+	now := c.now()
+	for userID, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, userID)
+		}
+	}
+	if len(c.entries) < c.maxEntries {
+		return
+	}
+	for userID := range c.entries {
+		delete(c.entries, userID)
+		return
+	}
+}
@@ -0,0 +1,80 @@
+package tokenversion
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCache(t *testing.T) {
+	userID := uuid.New()
+	stored := int32(3)
+	lookups := 0
+	c := New(time.Minute, 10, func(ctx context.Context, id uuid.UUID) (int32, error) {
+		lookups++
+		return stored, nil
+	})
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if v, err := c.Get(ctx, userID); err != nil || v != 3 {
+		t.Fatalf("Get() = %d, %v", v, err)
+	}
+	stored = 4
+	if v, _ := c.Get(ctx, userID); v != 3 || lookups != 1 {
+		t.Errorf("Get() = %d after %d lookups, want cached 3", v, lookups)
+	}
+
+	c.Set(userID, 4)
+	if v, _ := c.Get(ctx, userID); v != 4 || lookups != 1 {
+		t.Errorf("Get() = %d after Set, want 4", v)
+	}
+
+	stored = 5
+	now = now.Add(2 * time.Minute)
+	if v, _ := c.Get(ctx, userID); v != 5 || lookups != 2 {
+		t.Errorf("Get() = %d after expiry, want 5", v)
+	}
+
+	c.Forget(userID)
+	c.Get(ctx, userID)
+	if lookups != 3 {
+		t.Errorf("Get() after Forget didn't look the version up again")
+	}
+}
+
+func TestCacheDoesNotCacheErrors(t *testing.T) {
+	errLookup := errors.New("database is down")
+	fail := true
+	c := New(time.Minute, 10, func(ctx context.Context, id uuid.UUID) (int32, error) {
+		if fail {
+			return 0, errLookup
+		}
+		return 1, nil
+	})
+
+	userID := uuid.New()
+	if _, err := c.Get(context.Background(), userID); !errors.Is(err, errLookup) {
+		t.Fatalf("Get() error = %v, want %v", err, errLookup)
+	}
+	fail = false
+	if v, err := c.Get(context.Background(), userID); err != nil || v != 1 {
+		t.Errorf("Get() = %d, %v after the lookup recovered", v, err)
+	}
+}
+
+func TestCacheIsBounded(t *testing.T) {
+	c := New(time.Minute, 2, func(ctx context.Context, id uuid.UUID) (int32, error) {
+		return 0, nil
+	})
+	for range 5 {
+		c.Set(uuid.New(), 1)
+	}
+	if len(c.entries) > 2 {
+		t.Errorf("cache holds %d entries, want at most 2", len(c.entries))
+	}
+}
@@ -0,0 +1,35 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrNoHandler = errors.New("no handler for webhook event type")
+
+type HandlerFunc func(ctx context.Context, data json.RawMessage) error
+
+// Registry routes webhook events to the handler registered for their type.
+type Registry struct {
+	handlers map[string]HandlerFunc
+}
+
+func NewRegistry() *Registry {
+	return &Registry{handlers: map[string]HandlerFunc{}}
+}
+
+func (r *Registry) Handle(eventType string, handler HandlerFunc) {
+	r.handlers[eventType] = handler
+}
+
+// Dispatch runs the handler for eventType, or returns ErrNoHandler for
+// event types nobody has registered for.
+func (r *Registry) Dispatch(ctx context.Context, eventType string, data json.RawMessage) error {
+	handler, ok := r.handlers[eventType]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrNoHandler, eventType)
+	}
+	return handler(ctx, data)
+}
@@ -0,0 +1,35 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	var got string
+	r.Handle("user.upgraded", func(ctx context.Context, data json.RawMessage) error {
+		got = string(data)
+		return nil
+	})
+	errHandler := errors.New("handler failed")
+	r.Handle("user.downgraded", func(ctx context.Context, data json.RawMessage) error {
+		return errHandler
+	})
+
+	ctx := context.Background()
+	if err := r.Dispatch(ctx, "user.upgraded", json.RawMessage(`{"user_id":"1"}`)); err != nil {
+		t.Errorf("Dispatch() error = %v", err)
+	}
+	if got != `{"user_id":"1"}` {
+		t.Errorf("handler got %s", got)
+	}
+	if err := r.Dispatch(ctx, "user.downgraded", nil); !errors.Is(err, errHandler) {
+		t.Errorf("Dispatch() error = %v, want %v", err, errHandler)
+	}
+	if err := r.Dispatch(ctx, "user.deleted", nil); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("Dispatch() error = %v, want ErrNoHandler", err)
+	}
+}
@@ -0,0 +1,139 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	oldSecret := []byte("old-secret")
+	newSecret := []byte("new-secret")
+	body := []byte(`{"event":"user.upgraded"}`)
+	now := time.Unix(1700000000, 0)
+
+	v := NewVerifier([][]byte{newSecret, oldSecret}, 5*time.Minute)
+	v.now = func() time.Time { return now }
+
+	headers := func(timestamp int64, signature string) http.Header {
+		h := http.Header{}
+		h.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+		h.Set(SignatureHeader, signature)
+		return h
+	}
+	ts := now.Unix()
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		body    []byte
+		wantErr error
+	}{
+		{
+			name:   "Current secret",
+			header: headers(ts, "v1="+Sign(newSecret, ts, body)),
+			body:   body,
+		},
+		{
+			name:   "Previous secret during rotation",
+			header: headers(ts, "v1="+Sign(oldSecret, ts, body)),
+			body:   body,
+		},
+		{
+			name:   "One of several signatures matches",
+			header: headers(ts, "v1="+Sign([]byte("retired"), ts, body)+", v1="+Sign(newSecret, ts, body)),
+			body:   body,
+		},
+		{
+			name:    "Unknown secret",
+			header:  headers(ts, "v1="+Sign([]byte("retired"), ts, body)),
+			body:    body,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "Tampered body",
+			header:  headers(ts, "v1="+Sign(newSecret, ts, body)),
+			body:    []byte(`{"event":"user.downgraded"}`),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "Signature for another timestamp",
+			header:  headers(ts+1, "v1="+Sign(newSecret, ts, body)),
+			body:    body,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "Too old",
+			header:  headers(ts-600, "v1="+Sign(newSecret, ts-600, body)),
+			body:    body,
+			wantErr: ErrInvalidTimestamp,
+		},
+		{
+			name:    "Too far in the future",
+			header:  headers(ts+600, "v1="+Sign(newSecret, ts+600, body)),
+			body:    body,
+			wantErr: ErrInvalidTimestamp,
+		},
+		{
+			name:    "Unknown version",
+			header:  headers(ts, "v0="+Sign(newSecret, ts, body)),
+			body:    body,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "Missing headers",
+			header:  http.Header{},
+			body:    body,
+			wantErr: ErrMissingSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(tt.header, tt.body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyReplayKey(t *testing.T) {
+	oldSecret := []byte("old-secret")
+	newSecret := []byte("new-secret")
+	body := []byte(`{"event":"user.upgraded"}`)
+	now := time.Unix(1700000000, 0)
+	ts := now.Unix()
+
+	v := NewVerifier([][]byte{newSecret, oldSecret}, 5*time.Minute)
+	v.now = func() time.Time { return now }
+
+	verify := func(signature string) string {
+		t.Helper()
+		h := http.Header{}
+		h.Set(TimestampHeader, strconv.FormatInt(ts, 10))
+		h.Set(SignatureHeader, signature)
+		key, err := v.Verify(h, body)
+		if err != nil {
+			t.Fatalf("Verify(%q) error = %v", signature, err)
+		}
+		return key
+	}
+
+	sigOld := "v1=" + Sign(oldSecret, ts, body)
+	sigNew := "v1=" + Sign(newSecret, ts, body)
+	want := verify(sigOld + "," + sigNew)
+
+	// A captured delivery resent with only one of its signatures, or with
+	// them in another order, must map to the key already recorded.
+	for _, signature := range []string{sigOld, sigNew, sigNew + "," + sigOld} {
+		if got := verify(signature); got != want {
+			t.Errorf("Verify(%q) key = %q, want %q", signature, got, want)
+		}
+	}
+
+	if ReplayKey(ts+1, body) == want || ReplayKey(ts, []byte("{}")) == want {
+		t.Errorf("ReplayKey() doesn't depend on the timestamp and body")
+	}
+}
@@ -0,0 +1,106 @@
+package workpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var ErrSaturated = errors.New("worker pool is saturated")
+
+// Pool runs at most Size jobs at a time. Further callers queue for a free
+// slot for up to QueueTimeout and then get ErrSaturated, so a burst of work
+// turns into fast failures instead of unbounded memory use.
+type Pool struct {
+	size         int
+	queueTimeout time.Duration
+	slots        chan struct{}
+
+	running   atomic.Int64
+	queued    atomic.Int64
+	completed atomic.Int64
+	rejected  atomic.Int64
+	waitTotal atomic.Int64
+	waitMax   atomic.Int64
+}
+
+type Stats struct {
+	Size      int
+	Running   int64
+	Queued    int64
+	Completed int64
+	Rejected  int64
+	WaitTotal time.Duration
+	WaitMax   time.Duration
+}
+
+func New(size int, queueTimeout time.Duration) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{
+		size:         size,
+		queueTimeout: queueTimeout,
+		slots:        make(chan struct{}, size),
+	}
+}
+
+func (p *Pool) QueueTimeout() time.Duration {
+	return p.queueTimeout
+}
+
+// Do runs job on the calling goroutine once a slot is free. It returns
+// ErrSaturated if none frees up within the queue timeout, or the context's
+// error if ctx is done first.
+func (p *Pool) Do(ctx context.Context, job func()) error {
+	start := time.Now()
+	p.queued.Add(1)
+
+	timer := time.NewTimer(p.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-timer.C:
+		p.queued.Add(-1)
+		p.rejected.Add(1)
+		return ErrSaturated
+	case <-ctx.Done():
+		p.queued.Add(-1)
+		return ctx.Err()
+	}
+	p.queued.Add(-1)
+	p.recordWait(time.Since(start))
+
+	p.running.Add(1)
+	defer func() {
+		p.running.Add(-1)
+		p.completed.Add(1)
+		<-p.slots
+	}()
+	job()
+	return nil
+}
+
+func (p *Pool) recordWait(wait time.Duration) {
+	p.waitTotal.Add(int64(wait))
+	for {
+		longest := p.waitMax.Load()
+		if int64(wait) <= longest || p.waitMax.CompareAndSwap(longest, int64(wait)) {
+			return
+		}
+	}
+}
+
+func (p *Pool) Stats() Stats {
+	return Stats{
+		Size:      p.size,
+		Running:   p.running.Load(),
+		Queued:    p.queued.Load(),
+		Completed: p.completed.Load(),
+		Rejected:  p.rejected.Load(),
+		WaitTotal: time.Duration(p.waitTotal.Load()),
+		WaitMax:   time.Duration(p.waitMax.Load()),
+	}
+}
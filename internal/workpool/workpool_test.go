@@ -0,0 +1,60 @@
+package workpool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDoLimitsConcurrency(t *testing.T) {
+	p := New(1, 20*time.Millisecond)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- p.Do(context.Background(), func() {
+			close(started)
+			<-release
+		})
+	}()
+	<-started
+
+	err := p.Do(context.Background(), func() {
+		t.Error("job ran while the pool was full")
+	})
+	if !errors.Is(err, ErrSaturated) {
+		t.Errorf("Do() on a full pool error = %v, want ErrSaturated", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Do() error = %v", err)
+	}
+
+	ran := false
+	if err := p.Do(context.Background(), func() { ran = true }); err != nil || !ran {
+		t.Errorf("Do() after release = %v, ran = %v", err, ran)
+	}
+
+	stats := p.Stats()
+	if stats.Completed != 2 || stats.Rejected != 1 || stats.Running != 0 || stats.Queued != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestDoStopsWaitingWhenContextIsDone(t *testing.T) {
+	p := New(1, time.Minute)
+	p.slots <- struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := p.Do(ctx, func() {})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Do() error = %v, want context.Canceled", err)
+	}
+	if stats := p.Stats(); stats.Queued != 0 || stats.Rejected != 0 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
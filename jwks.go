@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+)
+
+// loadKeySet reads PEM private keys from the comma separated paths in
+// JWT_SIGNING_KEYS (the first one signs) and JWT_RETIRING_KEYS (verify only).
+func loadKeySet(platform string) (*auth.KeySet, error) {
+	keys := auth.NewKeySet()
+	loaded := 0
+	for _, env := range []struct {
+		name   string
+		status auth.KeyStatus
+	}{
+		{"JWT_SIGNING_KEYS", auth.KeyStatusActive},
+		{"JWT_RETIRING_KEYS", auth.KeyStatusRetiring},
+	} {
+		for _, path := range strings.Split(os.Getenv(env.name), ",") {
+			path = strings.TrimSpace(path)
+			if path == "" {
+				continue
+			}
+			key, err := keys.LoadPEMFile(path, env.status)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Loaded %s JWT key %s", key.Status, key.ID)
+			loaded++
+		}
+	}
+
+	if loaded > 0 {
+		return keys, nil
+	}
+	if platform != "dev" {
+		return nil, errors.New("JWT_SIGNING_KEYS is not set")
+	}
+
+	private, err := auth.GenerateEd25519Key()
+	if err != nil {
+		return nil, err
+	}
+	key, err := keys.Add(private, auth.KeyStatusActive)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("JWT_SIGNING_KEYS is not set, using ephemeral key %s", key.ID)
+	return keys, nil
+}
+
+func (cfg *apiConfig) jwks(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(res, http.StatusOK, cfg.jwtKeys.JWKS())
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/lockout"
+)
+
+// Failures older than loginFailureWindow no longer count towards a lockout.
+const loginFailureWindow = time.Hour
+
+var loginPolicies = map[lockout.Kind]lockout.Policy{
+	lockout.KindAccount: {Threshold: 5, Base: 30 * time.Second, Max: time.Hour},
+	lockout.KindIP:      {Threshold: 20, Base: 30 * time.Second, Max: time.Hour},
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkLoginLock responds with 429 and returns false while either the
+// account or the client address is locked out.
+func (cfg *apiConfig) checkLoginLock(res http.ResponseWriter, req *http.Request, email string) bool {
+	locks, err := cfg.dbQueries.GetLoginLocks(req.Context(), database.GetLoginLocksParams{
+		Email: normalizeEmail(email),
+		Ip:    clientIP(req),
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't check login attempts", err)
+		return false
+	}
+	if len(locks) == 0 {
+		return true
+	}
+
+	lockedUntil := locks[0].LockedUntil.Time
+	for _, lock := range locks[1:] {
+		if lock.LockedUntil.Time.After(lockedUntil) {
+			lockedUntil = lock.LockedUntil.Time
+		}
+	}
+
+	res.Header().Set("Retry-After", fmt.Sprint(lockout.RetryAfter(lockedUntil, time.Now().UTC())))
+	respondWithError(res, http.StatusTooManyRequests, "Too many failed login attempts, try again later", nil)
+	return false
+}
+
+func (cfg *apiConfig) recordLoginFailure(ctx context.Context, email, ip string) {
+	for kind, subject := range map[lockout.Kind]string{
+		lockout.KindAccount: normalizeEmail(email),
+		lockout.KindIP:      ip,
+	} {
+		attempt, err := cfg.dbQueries.RecordLoginFailure(ctx, database.RecordLoginFailureParams{
+			Kind:        string(kind),
+			Subject:     subject,
+			ResetBefore: time.Now().UTC().Add(-loginFailureWindow),
+		})
+		if err != nil {
+			log.Printf("Error recording failed login for %s %s: %s", kind, subject, err)
+			continue
+		}
+
+		backoff := loginPolicies[kind].Backoff(int(attempt.Failures))
+		if backoff == 0 {
+			continue
+		}
+		err = cfg.dbQueries.LockLoginSubject(ctx, database.LockLoginSubjectParams{
+			Kind:        string(kind),
+			Subject:     subject,
+			LockedUntil: sql.NullTime{Time: time.Now().UTC().Add(backoff), Valid: true},
+		})
+		if err != nil {
+			log.Printf("Error locking %s %s: %s", kind, subject, err)
+			continue
+		}
+		log.Printf("Locked out %s %s for %s after %d failed logins", kind, subject, backoff, attempt.Failures)
+	}
+}
+
+func (cfg *apiConfig) clearLoginFailures(ctx context.Context, email string) {
+	_, err := cfg.dbQueries.ClearLoginFailures(ctx, database.ClearLoginFailuresParams{
+		Kind:    string(lockout.KindAccount),
+		Subject: normalizeEmail(email),
+	})
+	if err != nil {
+		log.Printf("Error clearing failed logins for %s: %s", email, err)
+	}
+}
+
+func (cfg *apiConfig) unlockLogin(res http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+		IP    string `json:"ip"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	for kind, subject := range map[lockout.Kind]string{
+		lockout.KindAccount: normalizeEmail(params.Email),
+		lockout.KindIP:      strings.TrimSpace(params.IP),
+	} {
+		if subject == "" {
+			continue
+		}
+		cleared, err := cfg.dbQueries.ClearLoginFailures(req.Context(), database.ClearLoginFailuresParams{
+			Kind:    string(kind),
+			Subject: subject,
+		})
+		if err != nil {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't unlock login", err)
+			return
+		}
+		if cleared > 0 {
+			log.Printf("Admin unlocked %s %s", kind, subject)
+		}
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
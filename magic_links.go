@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/mailer"
+)
+
+// At most magicLinkLimit links are sent to one address per
+// magicLinkWindow.
+const (
+	magicLinkDuration = 15 * time.Minute
+	magicLinkLimit    = 5
+	magicLinkWindow   = time.Hour
+)
+
+func (cfg *apiConfig) requestMagicLink(res http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Email == "" {
+		respondWithError(res, http.StatusBadRequest, "Email is required", nil)
+		return
+	}
+
+	now := time.Now().UTC()
+	email := normalizeEmail(params.Email)
+	err = cfg.dbQueries.DeleteOldMagicLinkRequests(req.Context(), now.Add(-magicLinkWindow))
+	if err != nil {
+		log.Printf("Error deleting old magic link requests: %s", err)
+	}
+	err = cfg.dbQueries.RecordMagicLinkRequest(req.Context(), email)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't send sign-in link", err)
+		return
+	}
+	requests, err := cfg.dbQueries.CountMagicLinkRequestsSince(req.Context(), database.CountMagicLinkRequestsSinceParams{
+		Email:       email,
+		RequestedAt: now.Add(-magicLinkWindow),
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't send sign-in link", err)
+		return
+	}
+	if requests > magicLinkLimit {
+		res.Header().Set("Retry-After", fmt.Sprint(int(magicLinkWindow.Seconds())))
+		respondWithError(res, http.StatusTooManyRequests, "Too many sign-in links requested, try again later", nil)
+		return
+	}
+
+	// The response is the same whether or not the account exists, and so is
+	// the time it takes: looking the account up, creating the token and
+	// sending the mail happen after responding.
+	go cfg.sendMagicLink(params.Email)
+
+	res.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) sendMagicLink(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	user, err := cfg.dbQueries.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting user for sign-in link: %s", err)
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating sign-in link for user %s: %s", user.ID, err)
+		return
+	}
+
+	// Only the newest link works, so an older one found in a mailbox later
+	// can't be used.
+	err = cfg.dbQueries.DeleteUnusedMagicLinkTokens(ctx, user.ID)
+	if err != nil {
+		log.Printf("Error creating sign-in link for user %s: %s", user.ID, err)
+		return
+	}
+	err = cfg.dbQueries.CreateMagicLinkToken(ctx, database.CreateMagicLinkTokenParams{
+		TokenHash: auth.HashToken(token, cfg.tokenHashKey),
+		ExpiresAt: time.Now().UTC().Add(magicLinkDuration),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		log.Printf("Error creating sign-in link for user %s: %s", user.ID, err)
+		return
+	}
+
+	cfg.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Sign in to Chirpy",
+		Body: fmt.Sprintf("Open this link within the next 15 minutes to sign in to Chirpy:\n%s\n\n"+
+			"The link works once. If you didn't ask for it, you can ignore this email.\n",
+			cfg.baseURL+"/app/magic-login.html?token="+url.QueryEscape(token)),
+	})
+}
+
+// redeemMagicLink signs the user in the same way as a password login,
+// including the second factor when it is enabled.
+func (cfg *apiConfig) redeemMagicLink(res http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	token, err := cfg.dbQueries.ConsumeMagicLinkToken(req.Context(), auth.HashToken(params.Token, cfg.tokenHashKey))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusUnauthorized, "Sign-in link is invalid, expired or already used", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't sign in", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), token.UserID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't sign in", err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		cfg.requireMFA(res, user)
+		return
+	}
+	cfg.issueSession(res, req, user)
+}
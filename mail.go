@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/mailer"
+)
+
+// loadMailer picks the mail transport from MAILER: "smtp" delivers through
+// SMTP_HOST, "file" writes messages to MAIL_DIR, anything else logs them.
+func loadMailer() (mailer.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@chirpy.local>"
+	}
+
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST must be set when MAILER=smtp")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return mailer.NewSMTPMailer(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from), nil
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return &mailer.FileMailer{Dir: dir, From: from}, nil
+	default:
+		return mailer.LogMailer{}, nil
+	}
+}
+
+// sendMail delivers in the background so response times don't reveal
+// whether an address belongs to an account.
+func (cfg *apiConfig) sendMail(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		err := cfg.mailer.Send(ctx, msg)
+		if err != nil {
+			log.Printf("Error sending %q to %s: %s", msg.Subject, msg.To, err)
+		}
+	}()
+}
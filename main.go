@@ -1,23 +1,32 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
-	"sort"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/Wolfy-22/Chirpy.git/internal/auth"
 	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/mailer"
+	"github.com/Wolfy-22/Chirpy.git/internal/oidc"
+	"github.com/Wolfy-22/Chirpy.git/internal/pagination"
+	"github.com/Wolfy-22/Chirpy.git/internal/passwordpolicy"
+	"github.com/Wolfy-22/Chirpy.git/internal/tokenversion"
+	"github.com/Wolfy-22/Chirpy.git/internal/webhook"
+	"github.com/Wolfy-22/Chirpy.git/internal/workpool"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 const (
@@ -25,11 +34,22 @@ const (
 )
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	dbQueries      *database.Queries
-	platform       string
-	secret         string
-	polka_key      string
+	fileserverHits       atomic.Int32
+	db                   *sql.DB
+	dbQueries            *database.Queries
+	platform             string
+	jwtKeys              *auth.KeySet
+	tokenHashKey         []byte
+	totpKey              []byte
+	tokenVersions        *tokenversion.Cache
+	mailer               mailer.Mailer
+	baseURL              string
+	requireVerifiedEmail bool
+	oidcProviders        map[string]*oidc.Provider
+	passwordPool         *workpool.Pool
+	passwordPolicy       passwordpolicy.Policy
+	polkaWebhooks        *webhook.Verifier
+	polkaEvents          *webhook.Registry
 }
 
 func main() {
@@ -37,7 +57,10 @@ func main() {
 	dbURL := os.Getenv("DB_URL")
 	platform := os.Getenv("PLATFORM")
 	secret := os.Getenv("SECRET")
-	polkaKey := os.Getenv("POLKA_KEY")
+	if secret == "" {
+		log.Printf("SECRET must be set")
+		os.Exit(1)
+	}
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Printf("Error connecting to database: %s", err)
@@ -45,85 +68,166 @@ func main() {
 	}
 	dbQ := database.New(db)
 
-	mux := http.NewServeMux()
-	apiCfg := apiConfig{
-		fileserverHits: atomic.Int32{},
-		dbQueries:      dbQ,
-		platform:       platform,
-		secret:         secret,
-		polka_key:      polkaKey,
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bootstrap-admin":
+			if len(os.Args) != 3 {
+				log.Printf("Usage: %s bootstrap-admin <email>", os.Args[0])
+				os.Exit(2)
+			}
+			err := bootstrapAdmin(context.Background(), dbQ, os.Args[2])
+			if err != nil {
+				log.Printf("Error bootstrapping admin: %s", err)
+				os.Exit(1)
+			}
+			log.Printf("%s is now an admin", os.Args[2])
+			os.Exit(0)
+		default:
+			log.Printf("Unknown command %q", os.Args[1])
+			os.Exit(2)
+		}
 	}
 
-	mux.Handle("/app/", apiCfg.middlewareMetricsInc(handler()))
-
-	mux.HandleFunc("GET /api/healthz", endPointHandler)
-	mux.HandleFunc("POST /api/chirps", apiCfg.createChirp)
-	mux.HandleFunc("POST /api/users", apiCfg.addUser)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.writeNumberRequest)
-	mux.HandleFunc("POST /admin/reset", apiCfg.resetAll)
-	mux.HandleFunc("GET /api/chirps", apiCfg.getChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.getChirp)
-	mux.HandleFunc("POST /api/login", apiCfg.login)
-	mux.HandleFunc("POST /api/refresh", apiCfg.refresh)
-	mux.HandleFunc("POST /api/revoke", apiCfg.revokeToken)
-	mux.HandleFunc("PUT /api/users", apiCfg.updateUser)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.deleteChirp)
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.updateToRed)
-
-	server := http.Server{
-		Handler: mux,
-		Addr:    ":" + port,
+	passwordParams, err := loadPasswordParams()
+	if err != nil {
+		log.Printf("Error configuring password hashing: %s", err)
+		os.Exit(1)
 	}
+	auth.SetPasswordParams(passwordParams)
 
-	server.ListenAndServe()
-
-}
-
-func (cfg *apiConfig) updateToRed(res http.ResponseWriter, req *http.Request) {
-	type data struct {
-		UserID string `json:"user_id"`
-	}
-	type reqData struct {
-		Event string `json:"event"`
-		Data  data   `json:"data"`
+	passwordPool, err := loadPasswordPool()
+	if err != nil {
+		log.Printf("Error configuring password hashing: %s", err)
+		os.Exit(1)
 	}
 
-	decoder := json.NewDecoder(req.Body)
-	params := reqData{}
-	err := decoder.Decode(&params)
+	polkaWebhooks, err := loadPolkaVerifier()
 	if err != nil {
-		respondWithError(res, http.StatusInternalServerError, "Couldn't decode parameters", err)
-		return
+		log.Printf("Error configuring Polka webhooks: %s", err)
+		os.Exit(1)
 	}
 
-	if params.Event != "user.upgraded" {
-		respondWithError(res, 204, "Incorrect event", errors.New("event must be user.upgraded"))
-		return
+	passwordPolicy, err := loadPasswordPolicy()
+	if err != nil {
+		log.Printf("Error configuring password policy: %s", err)
+		os.Exit(1)
 	}
 
-	UserID, err := uuid.Parse(params.Data.UserID)
+	jwtKeys, err := loadKeySet(platform)
 	if err != nil {
-		respondWithError(res, http.StatusInternalServerError, "Error parsing ID", err)
-		return
+		log.Printf("Error loading JWT keys: %s", err)
+		os.Exit(1)
 	}
 
-	apiKey, err := auth.GetAPIKey(req.Header)
+	mailSender, err := loadMailer()
 	if err != nil {
-		respondWithError(res, http.StatusUnauthorized, "Couldn't find Key", err)
-		return
+		log.Printf("Error configuring mailer: %s", err)
+		os.Exit(1)
 	}
 
-	if apiKey != cfg.polka_key {
-		respondWithError(res, http.StatusUnauthorized, "Incorrect api key", err)
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + port
 	}
 
-	err = cfg.dbQueries.UpgradesToChirpyRedViaID(req.Context(), UserID)
+	oidcProviders, err := loadOIDCProviders(baseURL)
 	if err != nil {
-		respondWithError(res, http.StatusNotFound, "user id not found", err)
-		return
+		log.Printf("Error configuring OIDC providers: %s", err)
+		os.Exit(1)
 	}
 
-	res.WriteHeader(204)
+	mux := http.NewServeMux()
+	apiCfg := apiConfig{
+		fileserverHits:       atomic.Int32{},
+		db:                   db,
+		dbQueries:            dbQ,
+		platform:             platform,
+		jwtKeys:              jwtKeys,
+		tokenHashKey:         []byte(secret),
+		totpKey:              auth.DeriveKey([]byte(secret), "totp-secret"),
+		tokenVersions:        tokenversion.New(tokenVersionCacheTTL, tokenVersionCacheSize, dbQ.GetUserTokenVersion),
+		mailer:               mailSender,
+		baseURL:              baseURL,
+		requireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+		oidcProviders:        oidcProviders,
+		passwordPool:         passwordPool,
+		passwordPolicy:       passwordPolicy,
+		polkaWebhooks:        polkaWebhooks,
+	}
+	apiCfg.registerPolkaHandlers()
+	apiCfg.encryptTOTPSecrets(context.Background())
+
+	mux.Handle("/app/", apiCfg.middlewareMetricsInc(handler()))
+
+	mux.HandleFunc("GET /api/healthz", endPointHandler)
+	mux.Handle("POST /api/chirps", apiCfg.RequireScope(auth.ScopeChirpsWrite, http.HandlerFunc(apiCfg.createChirp)))
+	mux.HandleFunc("POST /api/users", apiCfg.addUser)
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("GET /admin/metrics", apiCfg.writeNumberRequest)
+	adminMux.HandleFunc("GET /admin/metrics/password-hashing", apiCfg.passwordPoolMetrics)
+	adminMux.HandleFunc("POST /admin/reset", apiCfg.resetAll)
+	adminMux.HandleFunc("POST /admin/unlock", apiCfg.unlockLogin)
+	adminMux.HandleFunc("PUT /admin/users/{userID}/role", apiCfg.setUserRole)
+	adminMux.HandleFunc("POST /admin/users/{userID}/suspend", apiCfg.suspendUser)
+	adminMux.HandleFunc("DELETE /admin/users/{userID}/suspend", apiCfg.unsuspendUser)
+	adminMux.HandleFunc("GET /admin/webhooks/events", apiCfg.listWebhookEvents)
+	adminMux.HandleFunc("POST /admin/webhooks/events/{eventID}/replay", apiCfg.replayWebhookEvent)
+	adminMux.HandleFunc("GET /admin/password-hashes", apiCfg.passwordHashReport)
+	adminMux.HandleFunc("POST /admin/users/{userID}/impersonate", apiCfg.startImpersonation)
+	adminMux.HandleFunc("DELETE /admin/impersonations/{impersonationID}", apiCfg.stopImpersonation)
+	adminMux.HandleFunc("GET /admin/audit-log", apiCfg.listAuditLog)
+	adminMux.HandleFunc("POST /admin/oauth/clients", apiCfg.createOAuthClient)
+	adminMux.HandleFunc("GET /admin/oauth/clients", apiCfg.listOAuthClients)
+	adminMux.HandleFunc("DELETE /admin/oauth/clients/{clientID}", apiCfg.revokeOAuthClient)
+	mux.Handle("/admin/", apiCfg.RequireAuth(apiCfg.requireRole(auth.RoleAdmin, adminMux)))
+	mux.HandleFunc("GET /api/chirps", apiCfg.getChirps)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.getChirp)
+	mux.HandleFunc("POST /api/login", apiCfg.login)
+	mux.HandleFunc("POST /api/refresh", apiCfg.refresh)
+	mux.HandleFunc("POST /api/revoke", apiCfg.revokeToken)
+	mux.Handle("PUT /api/users", apiCfg.RequireScope(auth.ScopeProfileWrite, denyImpersonation(http.HandlerFunc(apiCfg.updateUser))))
+	mux.Handle("DELETE /api/users/me", apiCfg.RequireAuth(denyImpersonation(http.HandlerFunc(apiCfg.deleteAccount))))
+	mux.Handle("GET /api/users/me/export", apiCfg.RequireAuth(denyImpersonation(http.HandlerFunc(apiCfg.exportAccount))))
+	mux.Handle("POST /api/users/me/exports", apiCfg.RequireAuth(denyImpersonation(http.HandlerFunc(apiCfg.createDataExport))))
+	mux.Handle("GET /api/users/me/exports/{exportID}", apiCfg.RequireAuth(denyImpersonation(http.HandlerFunc(apiCfg.getDataExport))))
+	mux.Handle("DELETE /api/chirps/{chirpID}", apiCfg.RequireScope(auth.ScopeChirpsDelete, http.HandlerFunc(apiCfg.deleteChirp)))
+	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.receivePolkaWebhook)
+	mux.HandleFunc("GET /.well-known/jwks.json", apiCfg.jwks)
+	mux.Handle("GET /api/sessions", apiCfg.RequireAuth(http.HandlerFunc(apiCfg.listSessions)))
+	mux.Handle("DELETE /api/sessions/{sessionID}", apiCfg.RequireAuth(denyImpersonation(http.HandlerFunc(apiCfg.deleteSession))))
+	mux.Handle("POST /api/sessions/revoke-all", apiCfg.RequireAuth(denyImpersonation(http.HandlerFunc(apiCfg.revokeOtherSessions))))
+	mux.HandleFunc("POST /api/login/mfa", apiCfg.loginMFA)
+	mux.HandleFunc("POST /api/login/magic", apiCfg.requestMagicLink)
+	mux.HandleFunc("POST /api/login/magic/redeem", apiCfg.redeemMagicLink)
+	mux.Handle("POST /api/mfa/totp", apiCfg.RequireAuth(denyImpersonation(http.HandlerFunc(apiCfg.enrollTOTP))))
+	mux.Handle("POST /api/mfa/totp/confirm", apiCfg.RequireAuth(denyImpersonation(http.HandlerFunc(apiCfg.confirmTOTP))))
+	mux.Handle("DELETE /api/mfa/totp", apiCfg.RequireAuth(denyImpersonation(http.HandlerFunc(apiCfg.disableTOTP))))
+	mux.Handle("POST /api/mfa/recovery-codes", apiCfg.RequireAuth(denyImpersonation(http.HandlerFunc(apiCfg.resetRecoveryCodes))))
+	mux.HandleFunc("POST /api/password-reset", apiCfg.requestPasswordReset)
+	mux.HandleFunc("POST /api/password-reset/confirm", apiCfg.confirmPasswordReset)
+	mux.HandleFunc("POST /api/users/verify-email", apiCfg.verifyEmail)
+	mux.Handle("POST /api/users/verify-email/resend", apiCfg.RequireAuth(http.HandlerFunc(apiCfg.resendVerificationEmail)))
+	mux.HandleFunc("GET /api/oauth/{provider}/start", apiCfg.oauthStart)
+	mux.HandleFunc("GET /api/oauth/{provider}/callback", apiCfg.oauthCallback)
+	mux.Handle("POST /api/tokens", apiCfg.RequireAuth(denyImpersonation(http.HandlerFunc(apiCfg.createPersonalAccessToken))))
+	mux.Handle("GET /api/tokens", apiCfg.RequireAuth(http.HandlerFunc(apiCfg.listPersonalAccessTokens)))
+	mux.Handle("DELETE /api/tokens/{tokenID}", apiCfg.RequireAuth(denyImpersonation(http.HandlerFunc(apiCfg.revokePersonalAccessToken))))
+	mux.Handle("GET /api/oauth2/authorize", apiCfg.OptionalAuth(http.HandlerFunc(apiCfg.authorize)))
+	mux.Handle("POST /api/oauth2/authorize", apiCfg.RequireAuth(denyImpersonation(http.HandlerFunc(apiCfg.approveAuthorization))))
+	mux.HandleFunc("POST /api/oauth2/token", apiCfg.oauthToken)
+	mux.HandleFunc("POST /api/oauth2/introspect", apiCfg.introspectToken)
+	mux.HandleFunc("POST /api/oauth2/revoke", apiCfg.revokeClientToken)
+
+	go apiCfg.expireSubscriptions(context.Background(), subscriptionExpiryInterval)
+	go apiCfg.purgeDeletedAccounts(context.Background(), accountPurgeInterval)
+
+	server := http.Server{
+		Handler: mux,
+		Addr:    ":" + port,
+	}
+
+	server.ListenAndServe()
+
 }
 
 func (cfg *apiConfig) deleteChirp(res http.ResponseWriter, req *http.Request) {
@@ -134,17 +238,7 @@ func (cfg *apiConfig) deleteChirp(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	accessToken, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		respondWithError(res, http.StatusUnauthorized, "Couldn't find token", err)
-		return
-	}
-
-	USER_ID, err := auth.ValidateJWT(accessToken, cfg.secret)
-	if err != nil {
-		respondWithError(res, 403, "Not author of chirp", err)
-		return
-	}
+	USER_ID := requestPrincipal(req).UserID
 
 	dbChirp, err := cfg.dbQueries.GetChirpByID(req.Context(), chirpID)
 	if err != nil {
@@ -152,8 +246,13 @@ func (cfg *apiConfig) deleteChirp(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 	if dbChirp.UserID != USER_ID {
-		respondWithError(res, http.StatusForbidden, "You can't delete this chirp", err)
-		return
+		// Moderators can take down anyone's chirps.
+		user, err := cfg.dbQueries.GetUserByID(req.Context(), USER_ID)
+		if err != nil || !auth.Role(user.Role).Includes(auth.RoleModerator) {
+			respondWithError(res, http.StatusForbidden, "You can't delete this chirp", err)
+			return
+		}
+		log.Printf("Moderator %s deleted chirp %s by %s", USER_ID, chirpID, dbChirp.UserID)
 	}
 
 	err = cfg.dbQueries.DeleteChirpByID(req.Context(), chirpID)
@@ -166,49 +265,108 @@ func (cfg *apiConfig) deleteChirp(res http.ResponseWriter, req *http.Request) {
 }
 
 func (cfg *apiConfig) updateUser(res http.ResponseWriter, req *http.Request) {
-	accessToken, err := auth.GetBearerToken(req.Header)
+	userID := requestPrincipal(req).UserID
+
+	type newUserDate struct {
+		NewEmail        string `json:"email"`
+		NewPassword     string `json:"password"`
+		CurrentPassword string `json:"current_password"`
+	}
+
+	type updateResponse struct {
+		ID            uuid.UUID `json:"id"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"email_verified"`
+		PendingEmail  string    `json:"pending_email,omitempty"`
+		ChirpyRed     bool      `json:"is_chirpy_red"`
+		AccessToken   string    `json:"token,omitempty"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := newUserDate{}
+	err := decoder.Decode(&params)
 	if err != nil {
-		respondWithError(res, http.StatusUnauthorized, "Couldn't find token", err)
+		respondWithError(res, http.StatusInternalServerError, "Couldn't decode parameters", err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(accessToken, cfg.secret)
+	currentUser, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
 	if err != nil {
-		respondWithError(res, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		respondWithError(res, http.StatusUnauthorized, "Couldn't find user", err)
 		return
 	}
 
-	type newUserDate struct {
-		NewEmail    string `json:"email"`
-		NewPassword string `json:"password"`
+	// Changing credentials needs the current password, so a stolen access
+	// token alone can't take the account over. Accounts without a password
+	// set one through password reset instead.
+	if !hasPassword(currentUser) {
+		respondWithError(res, http.StatusForbidden, "Account has no password, use password reset to set one", nil)
+		return
+	}
+	match, err := cfg.checkPassword(req.Context(), params.CurrentPassword, currentUser.HashedPassword)
+	if errors.Is(err, workpool.ErrSaturated) {
+		cfg.respondPasswordPoolBusy(res)
+		return
+	}
+	if err != nil || !match {
+		respondWithError(res, http.StatusUnauthorized, "Incorrect password", err)
+		return
 	}
 
-	type updateResponse struct {
-		ID        uuid.UUID `json:"id"`
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
-		Email     string    `json:"email"`
-		ChirpyRed bool      `json:"is_chirpy_red"`
+	// The password is only replaced, and other sessions only signed out, when
+	// a new one is given.
+	hashedPassword := sql.NullString{}
+	if params.NewPassword != "" {
+		if !cfg.checkPasswordPolicy(res, params.NewPassword, currentUser.Email, params.NewEmail) {
+			return
+		}
+
+		hash, err := cfg.hashPassword(req.Context(), params.NewPassword)
+		if errors.Is(err, workpool.ErrSaturated) {
+			cfg.respondPasswordPoolBusy(res)
+			return
+		}
+		if err != nil {
+			log.Printf("Error hashing password: %s", err)
+			res.WriteHeader(400)
+			return
+		}
+		hashedPassword = sql.NullString{String: hash, Valid: true}
 	}
 
-	decoder := json.NewDecoder(req.Body)
-	params := newUserDate{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		respondWithError(res, http.StatusInternalServerError, "Couldn't decode parameters", err)
+	// A new email only replaces the current one once it has been confirmed.
+	pendingEmail := sql.NullString{}
+	if params.NewEmail != "" && params.NewEmail != currentUser.Email {
+		_, err = cfg.dbQueries.GetUserByEmail(req.Context(), params.NewEmail)
+		if err == nil {
+			respondWithError(res, http.StatusConflict, "Email address is already in use", nil)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't update user", err)
+			return
+		}
+		pendingEmail = sql.NullString{String: params.NewEmail, Valid: true}
+	}
+
+	if !hashedPassword.Valid && !pendingEmail.Valid {
+		respondWithError(res, http.StatusBadRequest, "Nothing to update", nil)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.NewPassword)
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
 	if err != nil {
-		log.Printf("Error hashing password: %s", err)
-		res.WriteHeader(400)
+		respondWithError(res, http.StatusInternalServerError, "Couldn't update user", err)
 		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
 
-	user, err := cfg.dbQueries.UpdateUserEmailAndPasswordByUserID(req.Context(), database.UpdateUserEmailAndPasswordByUserIDParams{
-		Email:          params.NewEmail,
+	user, err := qtx.UpdateUserPasswordAndPendingEmailByUserID(req.Context(), database.UpdateUserPasswordAndPendingEmailByUserIDParams{
 		HashedPassword: hashedPassword,
+		PendingEmail:   pendingEmail,
 		ID:             userID,
 	})
 	if err != nil {
@@ -216,12 +374,70 @@ func (cfg *apiConfig) updateUser(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// A new password signs out every other session: the version bump ends
+	// their access tokens and revoking their refresh tokens stops them from
+	// getting new ones. Callers without a session, such as personal access
+	// tokens, sign out every session.
+	principal := requestPrincipal(req)
+	if hashedPassword.Valid {
+		_, err = qtx.RevokeOtherSessions(req.Context(), database.RevokeOtherSessionsParams{
+			UserID: user.ID,
+			ID:     principal.SessionID,
+		})
+		if err != nil {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't update user", err)
+			return
+		}
+		err = qtx.RevokeOtherRefreshTokens(req.Context(), database.RevokeOtherRefreshTokensParams{
+			UserID:   user.ID,
+			FamilyID: principal.SessionID,
+		})
+		if err != nil {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't update user", err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't update user", err)
+		return
+	}
+	cfg.tokenVersions.Set(user.ID, user.TokenVersion)
+
+	// The caller's own session gets a fresh access token so it carries on.
+	accessToken := ""
+	if hashedPassword.Valid {
+		accessToken, err = cfg.renewAccessToken(res, principal, user.TokenVersion)
+		if err != nil {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't create token", err)
+			return
+		}
+	}
+
+	if pendingEmail.Valid {
+		err = cfg.sendVerificationEmail(req.Context(), user.ID, pendingEmail.String)
+		if err != nil {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't send verification email", err)
+			return
+		}
+	}
+
+	chirpyRed, err := cfg.isChirpyRed(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't get subscription", err)
+		return
+	}
+
 	respondWithJSON(res, 200, updateResponse{
-		ID:        user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Email:     user.Email,
-		ChirpyRed: user.IsChirpyRed,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		PendingEmail:  user.PendingEmail.String,
+		ChirpyRed:     chirpyRed,
+		AccessToken:   accessToken,
 	})
 
 }
@@ -239,20 +455,23 @@ func (cfg *apiConfig) createChirp(res http.ResponseWriter, req *http.Request) {
 		Body string `json:"body"`
 	}
 
-	token, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		respondWithError(res, http.StatusUnauthorized, "Couldn't find JWT", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(token, cfg.secret)
-	if err != nil {
-		respondWithError(res, http.StatusUnauthorized, "Couldn't validate JWT", err)
-		return
+	userID := requestPrincipal(req).UserID
+
+	if cfg.requireVerifiedEmail {
+		user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+		if err != nil {
+			respondWithError(res, http.StatusUnauthorized, "Couldn't find user", err)
+			return
+		}
+		if !user.EmailVerifiedAt.Valid {
+			respondWithError(res, http.StatusForbidden, "Verify your email before posting chirps", nil)
+			return
+		}
 	}
 
 	decoder := json.NewDecoder(req.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
+	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(res, http.StatusInternalServerError, "Couldn't decode parameters", err)
 		return
@@ -283,13 +502,40 @@ func (cfg *apiConfig) createChirp(res http.ResponseWriter, req *http.Request) {
 }
 
 func (cfg *apiConfig) revokeToken(res http.ResponseWriter, req *http.Request) {
-	refreshToken, err := auth.GetBearerToken(req.Header)
+	refreshToken, fromCookie, err := refreshTokenFromRequest(req)
 	if err != nil {
 		respondWithError(res, http.StatusBadRequest, "Couldn't find token", err)
 		return
 	}
+	tokenHash := auth.HashToken(refreshToken, cfg.tokenHashKey)
 
-	_, err = cfg.dbQueries.RevokeRefreshToken(req.Context(), refreshToken)
+	if fromCookie {
+		token, err := cfg.dbQueries.GetRefreshToken(req.Context(), tokenHash)
+		if err != nil {
+			clearSessionCookies(res)
+			respondWithError(res, http.StatusUnauthorized, "Couldn't find session", err)
+			return
+		}
+		if !cfg.checkCSRF(req, token.FamilyID) {
+			respondWithError(res, http.StatusForbidden, "Missing or invalid CSRF token", nil)
+			return
+		}
+		clearSessionCookies(res)
+	}
+
+	token, err := cfg.dbQueries.RevokeRefreshToken(req.Context(), tokenHash)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+
+	err = cfg.dbQueries.RevokeSession(req.Context(), token.FamilyID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+
+	_, err = cfg.revokeAccessTokens(req.Context(), token.UserID)
 	if err != nil {
 		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke session", err)
 		return
@@ -300,52 +546,176 @@ func (cfg *apiConfig) revokeToken(res http.ResponseWriter, req *http.Request) {
 
 func (cfg *apiConfig) refresh(res http.ResponseWriter, req *http.Request) {
 	type refreshResponse struct {
-		Token string `json:"token"`
+		Token        string `json:"token,omitempty"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		CSRFToken    string `json:"csrf_token,omitempty"`
 	}
 
-	refreshToken, err := auth.GetBearerToken(req.Header)
+	refreshToken, fromCookie, err := refreshTokenFromRequest(req)
 	if err != nil {
 		respondWithError(res, http.StatusBadRequest, "Couldn't find token", err)
 		return
 	}
 
-	user, err := cfg.dbQueries.GetUserFromRefreshToken(req.Context(), refreshToken)
+	oldToken, err := cfg.dbQueries.GetRefreshToken(req.Context(), auth.HashToken(refreshToken, cfg.tokenHashKey))
+	if err != nil {
+		respondWithError(res, http.StatusUnauthorized, "Couldn't get user from refresh token", err)
+		return
+	}
+	if fromCookie && !cfg.checkCSRF(req, oldToken.FamilyID) {
+		respondWithError(res, http.StatusForbidden, "Missing or invalid CSRF token", nil)
+		return
+	}
+	if oldToken.ReplacedBy.Valid {
+		cfg.revokeStolenFamily(req, oldToken)
+		respondWithError(res, http.StatusUnauthorized, "Refresh token has already been used", nil)
+		return
+	}
+	if oldToken.RevokedAt.Valid || !oldToken.ExpiresAt.After(time.Now().UTC()) {
+		respondWithError(res, http.StatusUnauthorized, "Refresh token is expired or revoked", nil)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), oldToken.UserID)
 	if err != nil {
 		respondWithError(res, http.StatusUnauthorized, "Couldn't get user from refresh token", err)
 		return
 	}
+	if user.SuspendedAt.Valid {
+		respondWithError(res, http.StatusForbidden, "Account is suspended", nil)
+		return
+	}
+
+	// Tokens of OAuth clients are limited to their scopes and only refreshed
+	// through the OAuth token endpoint.
+	session, err := cfg.dbQueries.GetSessionByID(req.Context(), oldToken.FamilyID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't rotate refresh token", err)
+		return
+	}
+	if session.ClientID.Valid {
+		respondWithError(res, http.StatusUnauthorized, "Refresh token belongs to an OAuth client", nil)
+		return
+	}
+
+	newRefreshToken, err := cfg.rotateRefreshToken(req, oldToken)
+	if errors.Is(err, errRefreshTokenReused) {
+		respondWithError(res, http.StatusUnauthorized, "Refresh token has already been used", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't rotate refresh token", err)
+		return
+	}
 
 	accessToken, err := auth.MakeJWT(
-		user.ID,
-		cfg.secret,
+		oldToken.UserID,
+		cfg.jwtKeys,
 		time.Hour,
+		auth.WithSessionID(oldToken.FamilyID),
+		auth.WithRole(auth.Role(user.Role)),
+		auth.WithTokenVersion(user.TokenVersion),
 	)
 	if err != nil {
 		respondWithError(res, http.StatusUnauthorized, "Couldn't validate token", err)
 		return
 	}
 
+	if fromCookie {
+		cfg.setSessionCookies(res, oldToken.FamilyID, accessToken, newRefreshToken, time.Now().UTC().Add(time.Hour), oldToken.ExpiresAt)
+		respondWithJSON(res, http.StatusOK, refreshResponse{
+			CSRFToken: cfg.csrfToken(oldToken.FamilyID),
+		})
+		return
+	}
+
 	respondWithJSON(res, http.StatusOK, refreshResponse{
-		Token: accessToken,
+		Token:        accessToken,
+		RefreshToken: newRefreshToken,
 	})
 }
 
+// revokeStolenFamily is called when a refresh token that was already rotated
+// is presented again. Either the client or an attacker holds a copy, so every
+// token descended from the same login is revoked.
+func (cfg *apiConfig) revokeStolenFamily(req *http.Request, token database.RefreshToken) {
+	revoked, err := cfg.dbQueries.RevokeRefreshTokenFamily(req.Context(), token.FamilyID)
+	if err != nil {
+		log.Printf("Error revoking refresh token family %s: %s", token.FamilyID, err)
+		return
+	}
+	err = cfg.dbQueries.RevokeSession(req.Context(), token.FamilyID)
+	if err != nil {
+		log.Printf("Error revoking session %s: %s", token.FamilyID, err)
+	}
+	_, err = cfg.revokeAccessTokens(req.Context(), token.UserID)
+	if err != nil {
+		log.Printf("Error revoking access tokens of user %s: %s", token.UserID, err)
+	}
+	log.Printf("Suspected refresh token theft: reused token for user %s from %s, revoked %d tokens in family %s",
+		token.UserID, req.RemoteAddr, revoked, token.FamilyID)
+}
+
+var errRefreshTokenReused = errors.New("refresh token has already been used")
+
+// rotateRefreshToken replaces oldToken with a new refresh token in the same
+// family. If another request rotated oldToken first, the family is revoked
+// as stolen and errRefreshTokenReused returned.
+func (cfg *apiConfig) rotateRefreshToken(req *http.Request, oldToken database.RefreshToken) (string, error) {
+	newRefreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	newTokenHash := auth.HashToken(newRefreshToken, cfg.tokenHashKey)
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	_, err = qtx.CreateToken(req.Context(), database.CreateTokenParams{
+		TokenHash: newTokenHash,
+		UserID:    oldToken.UserID,
+		ExpiresAt: oldToken.ExpiresAt,
+		FamilyID:  oldToken.FamilyID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	_, err = qtx.RotateRefreshToken(req.Context(), database.RotateRefreshTokenParams{
+		TokenHash:  oldToken.TokenHash,
+		ReplacedBy: sql.NullString{String: newTokenHash, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// Another request rotated this token between our read and write.
+		tx.Rollback()
+		cfg.revokeStolenFamily(req, oldToken)
+		return "", errRefreshTokenReused
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = qtx.TouchSession(req.Context(), oldToken.FamilyID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return newRefreshToken, nil
+}
+
 func (cfg *apiConfig) login(res http.ResponseWriter, req *http.Request) {
 	type userData struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
 
-	type loginResponse struct {
-		ID           uuid.UUID `json:"id"`
-		CreatedAt    time.Time `json:"created_at"`
-		UpdatedAt    time.Time `json:"updated_at"`
-		Email        string    `json:"email"`
-		ChirpyRed    bool      `json:"is_chirpy_red"`
-		RefreshToken string    `json:"refresh_token"`
-		AccessToken  string    `json:"token"`
-	}
-
 	decoder := json.NewDecoder(req.Body)
 	Data := userData{}
 	err := decoder.Decode(&Data)
@@ -355,25 +725,96 @@ func (cfg *apiConfig) login(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if !cfg.checkLoginLock(res, req, Data.Email) {
+		return
+	}
+
 	user, err := cfg.dbQueries.GetUserByEmail(req.Context(), Data.Email)
 	if err != nil {
 		log.Printf("Error getting user: %s", err)
+		cfg.recordLoginFailure(req.Context(), Data.Email, clientIP(req))
 		res.WriteHeader(http.StatusUnauthorized)
 		res.Write([]byte("incorrect email or password"))
 
 		return
 	}
 
-	match, err := auth.CheckPasswordHash(Data.Password, user.HashedPassword)
+	match, err := cfg.checkPassword(req.Context(), Data.Password, user.HashedPassword)
+	if errors.Is(err, workpool.ErrSaturated) {
+		cfg.respondPasswordPoolBusy(res)
+		return
+	}
 	if err != nil || !match {
 		log.Printf("Error checking password: %s", err)
+		cfg.recordLoginFailure(req.Context(), Data.Email, clientIP(req))
 		res.WriteHeader(http.StatusUnauthorized)
 		res.Write([]byte("incorrect email or password"))
 
 		return
 	}
+	cfg.clearLoginFailures(req.Context(), Data.Email)
+	cfg.upgradePasswordHash(req.Context(), user, Data.Password)
+
+	if user.TotpEnabledAt.Valid {
+		cfg.requireMFA(res, user)
+		return
+	}
+
+	cfg.issueSession(res, req, user)
+}
+
+// issueSession starts a new session for a user who has fully authenticated
+// and responds with the access and refresh tokens for it, or sets them as
+// cookies when the client asked for a browser session.
+func (cfg *apiConfig) issueSession(res http.ResponseWriter, req *http.Request, user database.User) {
+	type loginResponse struct {
+		ID           uuid.UUID `json:"id"`
+		CreatedAt    time.Time `json:"created_at"`
+		UpdatedAt    time.Time `json:"updated_at"`
+		Email        string    `json:"email"`
+		ChirpyRed    bool      `json:"is_chirpy_red"`
+		Role         auth.Role `json:"role"`
+		RefreshToken string    `json:"refresh_token,omitempty"`
+		AccessToken  string    `json:"token,omitempty"`
+		CSRFToken    string    `json:"csrf_token,omitempty"`
+	}
+
+	if user.SuspendedAt.Valid {
+		respondWithError(res, http.StatusForbidden, "Account is suspended", nil)
+		return
+	}
+
+	// Signing in during the deletion grace period keeps the account.
+	if user.DeletionScheduledAt.Valid {
+		err := cfg.dbQueries.CancelUserDeletion(req.Context(), user.ID)
+		if err != nil {
+			log.Printf("Error canceling account deletion: %v", err)
+			res.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Canceled scheduled deletion of user %s", user.ID)
+	}
+
+	session, err := cfg.dbQueries.CreateSession(req.Context(), database.CreateSessionParams{
+		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
+		UserAgent: req.UserAgent(),
+		IpAddress: clientIP(req),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		log.Printf("Error creating session: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
-	access_token, err := auth.MakeJWT(user.ID, cfg.secret, time.Hour)
+	access_token, err := auth.MakeJWT(
+		user.ID,
+		cfg.jwtKeys,
+		time.Hour,
+		auth.WithSessionID(session.ID),
+		auth.WithRole(auth.Role(user.Role)),
+		auth.WithTokenVersion(user.TokenVersion),
+	)
 	if err != nil {
 		log.Printf("Error genrating access token: %v", err)
 		res.WriteHeader(400)
@@ -388,23 +829,38 @@ func (cfg *apiConfig) login(res http.ResponseWriter, req *http.Request) {
 	}
 
 	_, err = cfg.dbQueries.CreateToken(req.Context(), database.CreateTokenParams{
-		Token:     refresh_token,
+		TokenHash: auth.HashToken(refresh_token, cfg.tokenHashKey),
 		UserID:    user.ID,
-		ExpiresAt: time.Now().UTC().Add(time.Hour * 24 * 60),
+		ExpiresAt: session.ExpiresAt,
+		FamilyID:  session.ID,
 	})
 	if err != nil {
 		log.Printf("Error saving refresh token: %v", err)
 	}
 
+	chirpyRed, err := cfg.isChirpyRed(req.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error getting subscription: %v", err)
+		res.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	respBody := loginResponse{
 		ID:           user.ID,
 		CreatedAt:    user.CreatedAt,
 		UpdatedAt:    user.UpdatedAt,
 		Email:        user.Email,
-		ChirpyRed:    user.IsChirpyRed,
+		ChirpyRed:    chirpyRed,
+		Role:         auth.Role(user.Role),
 		AccessToken:  access_token,
 		RefreshToken: refresh_token,
 	}
+	if cookieMode(req) {
+		cfg.setSessionCookies(res, session.ID, access_token, refresh_token, time.Now().UTC().Add(time.Hour), session.ExpiresAt)
+		respBody.AccessToken = ""
+		respBody.RefreshToken = ""
+		respBody.CSRFToken = cfg.csrfToken(session.ID)
+	}
 
 	dat, err := json.Marshal(respBody)
 	if err != nil {
@@ -469,34 +925,62 @@ func (cfg *apiConfig) getChirps(res http.ResponseWriter, req *http.Request) {
 		UserID    uuid.UUID `json:"user_id"`
 	}
 
-	sortType := req.URL.Query().Get("sort")
-
-	chirps, err := cfg.dbQueries.GetAllChirpsAsc(req.Context())
-	if err != nil {
-		log.Printf("Error getting chirps: %s", err)
-		res.WriteHeader(400)
-		return
-	}
+	query := req.URL.Query()
 
-	query := req.URL.Query().Get("author_id")
-	if query != "" {
-		userID, err := uuid.Parse(query)
+	params := database.ListChirpsAscParams{MaxChirps: 50}
+	if value := query.Get("author_id"); value != "" {
+		userID, err := uuid.Parse(value)
 		if err != nil {
-			respondWithError(res, http.StatusInternalServerError, "Could not parse userID", err)
+			respondWithError(res, http.StatusBadRequest, "Could not parse author_id", err)
 			return
 		}
-		chirps, err = cfg.dbQueries.GetChirpsByUserIDAsc(req.Context(), userID)
+		params.UserID = uuid.NullUUID{UUID: userID, Valid: true}
+	}
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 500 {
+			respondWithError(res, http.StatusBadRequest, "limit must be between 1 and 500", err)
+			return
+		}
+		params.MaxChirps = int32(n)
+	}
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := pagination.Decode(value)
 		if err != nil {
-			respondWithError(res, http.StatusInternalServerError, "Error retrieving chirps", err)
+			respondWithError(res, http.StatusBadRequest, "Invalid cursor", err)
 			return
 		}
+		params.AfterCreatedAt = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: cursor.ID, Valid: true}
 	}
 
-	if sortType == "desc" {
-		sort.Slice(chirps, func(i, j int) bool { return chirps[i].CreatedAt.After(chirps[j].CreatedAt) })
+	// Fetch one extra chirp to find out whether there's another page.
+	limit := params.MaxChirps
+	params.MaxChirps++
+
+	var chirps []database.Chirp
+	var err error
+	if query.Get("sort") == "desc" {
+		chirps, err = cfg.dbQueries.ListChirpsDesc(req.Context(), database.ListChirpsDescParams(params))
+	} else {
+		chirps, err = cfg.dbQueries.ListChirpsAsc(req.Context(), params)
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Error retrieving chirps", err)
+		return
 	}
 
-	var fixedChirps []Chirp
+	// The response stays a plain array; the next page is linked from the
+	// Link header, carrying over the other query parameters.
+	if len(chirps) > int(limit) {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		query.Set("cursor", pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode())
+		next := url.URL{Path: req.URL.Path, RawQuery: query.Encode()}
+		res.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"next\"", cfg.baseURL, next.RequestURI()))
+	}
+
+	fixedChirps := []Chirp{}
 	var fixedChrip Chirp
 	for _, chirp := range chirps {
 		fixedChrip = Chirp{
@@ -519,12 +1003,13 @@ func (cfg *apiConfig) addUser(res http.ResponseWriter, req *http.Request) {
 	}
 
 	type userData struct {
-		ID        uuid.UUID `json:"id"`
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
-		Email     string    `json:"email"`
-		Password  string    `json:"hashed_password"`
-		ChirpyRed bool      `json:"is_chirpy_red"`
+		ID            uuid.UUID `json:"id"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"email_verified"`
+		Password      string    `json:"hashed_password"`
+		ChirpyRed     bool      `json:"is_chirpy_red"`
 	}
 
 	decoder := json.NewDecoder(req.Body)
@@ -536,7 +1021,15 @@ func (cfg *apiConfig) addUser(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(Data.Password)
+	if !cfg.checkPasswordPolicy(res, Data.Password, Data.Email) {
+		return
+	}
+
+	hashedPassword, err := cfg.hashPassword(req.Context(), Data.Password)
+	if errors.Is(err, workpool.ErrSaturated) {
+		cfg.respondPasswordPoolBusy(res)
+		return
+	}
 	if err != nil {
 		log.Printf("Error hashing password: %s", err)
 		res.WriteHeader(400)
@@ -553,12 +1046,25 @@ func (cfg *apiConfig) addUser(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	err = cfg.sendVerificationEmail(req.Context(), user.ID, user.Email)
+	if err != nil {
+		log.Printf("Error sending verification email: %s", err)
+	}
+
+	chirpyRed, err := cfg.isChirpyRed(req.Context(), user.ID)
+	if err != nil {
+		log.Printf("Error getting subscription: %s", err)
+		res.WriteHeader(500)
+		return
+	}
+
 	respBody := userData{
-		ID:        user.ID,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
-		Email:     user.Email,
-		ChirpyRed: user.IsChirpyRed,
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		ChirpyRed:     chirpyRed,
 	}
 
 	dat, err := json.Marshal(respBody)
@@ -626,6 +1132,7 @@ func (cfg *apiConfig) writeNumberRequest(res http.ResponseWriter, req *http.Requ
 }
 
 func (cfg *apiConfig) resetAll(res http.ResponseWriter, req *http.Request) {
+	// Even admins only get to wipe every account on a development database.
 	if cfg.platform != "dev" {
 		res.WriteHeader(403)
 		res.Write([]byte("Forbidden\n"))
@@ -669,3 +1176,8 @@ func respondWithJSON(req http.ResponseWriter, code int, payload interface{}) {
 	req.WriteHeader(code)
 	req.Write(dat)
 }
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/tokenversion"
+	"github.com/Wolfy-22/Chirpy.git/internal/workpool"
+	"github.com/google/uuid"
+)
+
+const testSecret = "test-secret"
+
+// newTestConfig returns a config backed by a mock database. Queries are
+// expected by their sqlc name with expectQuery and expectExec, in order.
+func newTestConfig(t *testing.T) (*apiConfig, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	keys := auth.NewKeySet()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Add(private, auth.KeyStatusActive); err != nil {
+		t.Fatal(err)
+	}
+
+	dbQueries := database.New(db)
+	return &apiConfig{
+		db:            db,
+		dbQueries:     dbQueries,
+		platform:      "dev",
+		jwtKeys:       keys,
+		tokenHashKey:  []byte(testSecret),
+		totpKey:       auth.DeriveKey([]byte(testSecret), "totp-secret"),
+		tokenVersions: tokenversion.New(time.Minute, 100, dbQueries.GetUserTokenVersion),
+		baseURL:       "https://chirpy.test",
+		passwordPool:  workpool.New(1, time.Second),
+	}, mock
+}
+
+func queryPattern(name string) string {
+	return regexp.QuoteMeta("-- name: "+name+" ") + ".*"
+}
+
+// expectQuery expects a :one or :many query.
+func expectQuery(mock sqlmock.Sqlmock, name string) *sqlmock.ExpectedQuery {
+	return mock.ExpectQuery(queryPattern(name))
+}
+
+// expectExec expects an :exec or :execrows query.
+func expectExec(mock sqlmock.Sqlmock, name string) *sqlmock.ExpectedExec {
+	return mock.ExpectExec(queryPattern(name))
+}
+
+// withPrincipal returns req as RequireAuth would pass it on for principal.
+func withPrincipal(req *http.Request, principal *Principal) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), principalKey{}, principal))
+}
+
+func userRows(user database.User) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "created_at", "updated_at", "email", "hashed_password", "totp_secret", "totp_enabled_at", "totp_last_step", "email_verified_at", "pending_email", "role", "token_version", "suspended_at", "deletion_scheduled_at"}).
+		AddRow(user.ID.String(), user.CreatedAt, user.UpdatedAt, user.Email, user.HashedPassword, nil, nil, user.TotpLastStep, nil, nil, user.Role, user.TokenVersion, nil, user.DeletionScheduledAt)
+}
+
+// testUser has no password, as if it signed up with OIDC.
+func testUser() database.User {
+	now := time.Now().UTC()
+	return database.User{
+		ID:             uuid.New(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		Email:          "user@example.com",
+		HashedPassword: unsetPasswordHash,
+		Role:           string(auth.RoleUser),
+	}
+}
+
+func refreshTokenRows(token database.RefreshToken) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"token_hash", "created_at", "updated_at", "expires_at", "revoked_at", "user_id", "family_id", "replaced_by"}).
+		AddRow(token.TokenHash, token.CreatedAt, token.UpdatedAt, token.ExpiresAt, token.RevokedAt, token.UserID.String(), token.FamilyID.String(), nil)
+}
+
+func TestUpdateUserPasswordSignsOutOtherSessions(t *testing.T) {
+	cfg, mock := newTestConfig(t)
+	user := testUser()
+	hash, err := auth.HashPassword("old-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.HashedPassword = hash
+	sessionID := uuid.New()
+
+	updated := user
+	updated.TokenVersion = user.TokenVersion + 1
+	expectQuery(mock, "GetUserByID").WithArgs(user.ID).WillReturnRows(userRows(user))
+	mock.ExpectBegin()
+	expectQuery(mock, "UpdateUserPasswordAndPendingEmailByUserID").WillReturnRows(userRows(updated))
+	expectExec(mock, "RevokeOtherSessions").WithArgs(user.ID, sessionID).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectExec(mock, "RevokeOtherRefreshTokens").WithArgs(user.ID, sessionID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectQuery(mock, "HasActiveSubscription").WithArgs(user.ID).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(`{"current_password":"old-password","password":"a new passphrase"}`))
+	req = withPrincipal(req, &Principal{UserID: user.ID, Method: authMethodAccessToken, SessionID: sessionID})
+	res := httptest.NewRecorder()
+	cfg.updateUser(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("updateUser status = %d, want %d: %s", res.Code, http.StatusOK, res.Body)
+	}
+
+	// The refresh token of another session was revoked along with it.
+	now := time.Now().UTC()
+	expectQuery(mock, "GetRefreshToken").WillReturnRows(refreshTokenRows(database.RefreshToken{
+		TokenHash: "hash",
+		CreatedAt: now.Add(-time.Hour),
+		UpdatedAt: now,
+		ExpiresAt: now.Add(24 * time.Hour),
+		RevokedAt: sql.NullTime{Time: now, Valid: true},
+		UserID:    user.ID,
+		FamilyID:  uuid.New(),
+	}))
+
+	req = httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+	req.Header.Set("Authorization", "Bearer old-refresh-token")
+	res = httptest.NewRecorder()
+	cfg.refresh(res, req)
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("refresh status = %d, want %d: %s", res.Code, http.StatusUnauthorized, res.Body)
+	}
+}
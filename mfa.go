@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/workpool"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer        = "Chirpy"
+	mfaTokenDuration  = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+var (
+	errSecondFactor = errors.New("invalid two-factor code")
+	errMFATokenUsed = errors.New("MFA token has already been used")
+)
+
+// requireMFA answers a correct email and password for an account with TOTP
+// enabled. The client exchanges the token and a code at /api/login/mfa.
+func (cfg *apiConfig) requireMFA(res http.ResponseWriter, user database.User) {
+	type mfaResponse struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+
+	mfaToken, err := auth.MakeMFAToken(user.ID, cfg.jwtKeys, mfaTokenDuration)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't create MFA token", err)
+		return
+	}
+
+	respondWithJSON(res, http.StatusOK, mfaResponse{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+	})
+}
+
+func (cfg *apiConfig) loginMFA(res http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	claims, err := auth.ParseMFAToken(params.MFAToken, cfg.jwtKeys)
+	if err != nil {
+		respondWithError(res, http.StatusUnauthorized, "Couldn't validate MFA token", err)
+		return
+	}
+	userID, _ := claims.UserID()
+
+	// Each MFA token gets one attempt. A wrong code means signing in with
+	// the password again, so a captured token can't be used to guess codes.
+	err = cfg.useMFAToken(req.Context(), claims)
+	if err != nil {
+		respondWithError(res, http.StatusUnauthorized, "Couldn't validate MFA token", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), userID)
+	if err != nil {
+		respondWithError(res, http.StatusUnauthorized, "Couldn't find user", err)
+		return
+	}
+
+	if !cfg.checkLoginLock(res, req, user.Email) {
+		return
+	}
+
+	err = cfg.verifySecondFactor(req.Context(), user, params.Code, params.RecoveryCode)
+	if err != nil {
+		cfg.recordLoginFailure(req.Context(), user.Email, clientIP(req))
+		respondWithError(res, http.StatusUnauthorized, "Invalid two-factor code", err)
+		return
+	}
+	cfg.clearLoginFailures(req.Context(), user.Email)
+
+	cfg.issueSession(res, req, user)
+}
+
+func (cfg *apiConfig) useMFAToken(ctx context.Context, claims *auth.AccessClaims) error {
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return fmt.Errorf("MFA token has no ID: %w", err)
+	}
+
+	err = cfg.dbQueries.DeleteExpiredMFATokens(ctx)
+	if err != nil {
+		return err
+	}
+	used, err := cfg.dbQueries.UseMFAToken(ctx, database.UseMFATokenParams{
+		TokenID:   tokenID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	})
+	if err != nil {
+		return err
+	}
+	if used == 0 {
+		return errMFATokenUsed
+	}
+	return nil
+}
+
+func (cfg *apiConfig) enrollTOTP(res http.ResponseWriter, req *http.Request) {
+	type enrollResponse struct {
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}
+
+	user, ok := cfg.authenticatedUser(res, req)
+	if !ok {
+		return
+	}
+	if user.TotpEnabledAt.Valid {
+		respondWithError(res, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't create TOTP secret", err)
+		return
+	}
+
+	encrypted, err := auth.EncryptSecret(secret, cfg.totpKey)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't save TOTP secret", err)
+		return
+	}
+
+	err = cfg.dbQueries.SetPendingTOTPSecret(req.Context(), database.SetPendingTOTPSecretParams{
+		TotpSecret: sql.NullString{String: encrypted, Valid: true},
+		ID:         user.ID,
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't save TOTP secret", err)
+		return
+	}
+
+	respondWithJSON(res, http.StatusOK, enrollResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(totpIssuer, user.Email, secret),
+	})
+}
+
+func (cfg *apiConfig) confirmTOTP(res http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Code string `json:"code"`
+	}
+
+	user, ok := cfg.authenticatedUser(res, req)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		respondWithError(res, http.StatusConflict, "Two-factor authentication is already enabled", nil)
+		return
+	}
+	if !user.TotpSecret.Valid {
+		respondWithError(res, http.StatusBadRequest, "Two-factor enrollment hasn't been started", nil)
+		return
+	}
+
+	secret, err := auth.DecryptSecret(user.TotpSecret.String, cfg.totpKey)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't read TOTP secret", err)
+		return
+	}
+
+	step, err := auth.ValidateTOTP(secret, params.Code, time.Now())
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Invalid two-factor code", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	err = qtx.EnableTOTP(req.Context(), database.EnableTOTPParams{
+		TotpLastStep: step,
+		ID:           user.ID,
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+
+	codes, err := cfg.replaceRecoveryCodes(req.Context(), qtx, user.ID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't enable two-factor authentication", err)
+		return
+	}
+
+	respondWithRecoveryCodes(res, codes)
+}
+
+func (cfg *apiConfig) disableTOTP(res http.ResponseWriter, req *http.Request) {
+	user, ok := cfg.reauthenticate(res, req)
+	if !ok {
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	err = qtx.DisableTOTP(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+
+	err = qtx.DeleteRecoveryCodes(req.Context(), user.ID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't disable two-factor authentication", err)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) resetRecoveryCodes(res http.ResponseWriter, req *http.Request) {
+	user, ok := cfg.reauthenticate(res, req)
+	if !ok {
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+	defer tx.Rollback()
+
+	codes, err := cfg.replaceRecoveryCodes(req.Context(), cfg.dbQueries.WithTx(tx), user.ID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't create recovery codes", err)
+		return
+	}
+
+	respondWithRecoveryCodes(res, codes)
+}
+
+// reauthenticate guards changes to two-factor settings: on top of a valid
+// access token the caller must send their password and a current code.
+func (cfg *apiConfig) reauthenticate(res http.ResponseWriter, req *http.Request) (database.User, bool) {
+	type parameters struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	user, ok := cfg.authenticatedUser(res, req)
+	if !ok {
+		return database.User{}, false
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return database.User{}, false
+	}
+
+	if !user.TotpEnabledAt.Valid {
+		respondWithError(res, http.StatusBadRequest, "Two-factor authentication isn't enabled", nil)
+		return database.User{}, false
+	}
+
+	match, err := cfg.checkPassword(req.Context(), params.Password, user.HashedPassword)
+	if errors.Is(err, workpool.ErrSaturated) {
+		cfg.respondPasswordPoolBusy(res)
+		return database.User{}, false
+	}
+	if err != nil || !match {
+		respondWithError(res, http.StatusUnauthorized, "Incorrect password", err)
+		return database.User{}, false
+	}
+
+	err = cfg.verifySecondFactor(req.Context(), user, params.Code, params.RecoveryCode)
+	if err != nil {
+		respondWithError(res, http.StatusUnauthorized, "Invalid two-factor code", err)
+		return database.User{}, false
+	}
+
+	return user, true
+}
+
+// verifySecondFactor accepts either a TOTP code, which can't be replayed
+// within its time step, or an unused recovery code, which is burned.
+func (cfg *apiConfig) verifySecondFactor(ctx context.Context, user database.User, code, recoveryCode string) error {
+	if !user.TotpEnabledAt.Valid || !user.TotpSecret.Valid {
+		return errSecondFactor
+	}
+
+	if code != "" {
+		secret, err := auth.DecryptSecret(user.TotpSecret.String, cfg.totpKey)
+		if err != nil {
+			return err
+		}
+		step, err := auth.ValidateTOTP(secret, code, time.Now())
+		if err != nil {
+			return err
+		}
+		used, err := cfg.dbQueries.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			TotpLastStep: step,
+			ID:           user.ID,
+		})
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return errSecondFactor
+		}
+		return nil
+	}
+
+	if recoveryCode != "" {
+		used, err := cfg.dbQueries.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   user.ID,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(recoveryCode), cfg.tokenHashKey),
+		})
+		if err != nil {
+			return err
+		}
+		if used == 0 {
+			return errSecondFactor
+		}
+		return nil
+	}
+
+	return errSecondFactor
+}
+
+func (cfg *apiConfig) replaceRecoveryCodes(ctx context.Context, q *database.Queries, userID uuid.UUID) ([]string, error) {
+	err := q.DeleteRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		err = q.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code), cfg.tokenHashKey),
+			UserID:   userID,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// encryptTOTPSecrets encrypts TOTP secrets stored before they were encrypted
+// at rest. Until it has run they are still read as plaintext.
+func (cfg *apiConfig) encryptTOTPSecrets(ctx context.Context) {
+	rows, err := cfg.dbQueries.ListPlaintextTOTPSecrets(ctx)
+	if err != nil {
+		log.Printf("Error listing TOTP secrets: %s", err)
+		return
+	}
+	for _, row := range rows {
+		encrypted, err := auth.EncryptSecret(row.TotpSecret.String, cfg.totpKey)
+		if err != nil {
+			log.Printf("Error encrypting TOTP secret of user %s: %s", row.ID, err)
+			continue
+		}
+		err = cfg.dbQueries.EncryptTOTPSecret(ctx, database.EncryptTOTPSecretParams{
+			TotpSecret: sql.NullString{String: encrypted, Valid: true},
+			ID:         row.ID,
+		})
+		if err != nil {
+			log.Printf("Error encrypting TOTP secret of user %s: %s", row.ID, err)
+		}
+	}
+	if len(rows) > 0 {
+		log.Printf("Encrypted %d TOTP secrets", len(rows))
+	}
+}
+
+func respondWithRecoveryCodes(res http.ResponseWriter, codes []string) {
+	type recoveryCodesResponse struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	respondWithJSON(res, http.StatusOK, recoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+// authenticatedUser loads the caller of a route behind RequireAuth.
+func (cfg *apiConfig) authenticatedUser(res http.ResponseWriter, req *http.Request) (database.User, bool) {
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), requestPrincipal(req).UserID)
+	if err != nil {
+		respondWithError(res, http.StatusUnauthorized, "Couldn't find user", err)
+		return database.User{}, false
+	}
+	return user, true
+}
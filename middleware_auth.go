@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/google/uuid"
+)
+
+type authMethod string
+
+const (
+	authMethodAccessToken         authMethod = "access_token"
+	authMethodPersonalAccessToken authMethod = "personal_access_token"
+	authMethodSessionCookie       authMethod = "session_cookie"
+)
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID uuid.UUID
+	Role   auth.Role
+	Method authMethod
+	// SessionID is the login session an access token or session cookie
+	// belongs to, or uuid.Nil for personal access tokens.
+	SessionID uuid.UUID
+	// Scopes limit what a personal access token or an OAuth client's token
+	// may do. Other access tokens act with the user's full rights and have
+	// none.
+	Scopes []auth.Scope
+	// ClientID is the OAuth client an access token was issued to, if any.
+	ClientID uuid.UUID
+	// ActorID is the admin behind an impersonation token, and
+	// ImpersonationID the impersonation it was issued for.
+	ActorID         uuid.UUID
+	ImpersonationID uuid.UUID
+}
+
+func (p *Principal) Impersonating() bool {
+	return p.ActorID != uuid.Nil
+}
+
+// Scoped reports whether the principal is limited to Scopes.
+func (p *Principal) Scoped() bool {
+	return p.Method == authMethodPersonalAccessToken || p.ClientID != uuid.Nil
+}
+
+type principalKey struct{}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	principal, ok := PrincipalFromContext(ctx)
+	if !ok {
+		return uuid.Nil, false
+	}
+	return principal.UserID, true
+}
+
+// requestPrincipal is for handlers behind RequireAuth or RequireScope, which
+// guarantee a principal. It returns nil anywhere else.
+func requestPrincipal(req *http.Request) *Principal {
+	principal, _ := PrincipalFromContext(req.Context())
+	return principal
+}
+
+// RequireAuth only lets authenticated requests through, answering 401
+// otherwise. Scoped tokens are refused with 403; routes that accept them use
+// RequireScope instead.
+func (cfg *apiConfig) RequireAuth(next http.Handler) http.Handler {
+	return cfg.authenticate(next, true, "")
+}
+
+// RequireScope is RequireAuth for routes that also accept scoped tokens
+// holding scope.
+func (cfg *apiConfig) RequireScope(scope auth.Scope, next http.Handler) http.Handler {
+	return cfg.authenticate(next, true, scope)
+}
+
+// OptionalAuth lets anonymous requests through without a principal. Bad
+// credentials are still refused rather than silently ignored.
+func (cfg *apiConfig) OptionalAuth(next http.Handler) http.Handler {
+	return cfg.authenticate(next, false, "")
+}
+
+func (cfg *apiConfig) authenticate(next http.Handler, required bool, scope auth.Scope) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		principal, err := cfg.resolvePrincipal(req)
+		if errors.Is(err, errInvalidCredentials) {
+			respondUnauthorized(res, "Invalid or expired credentials", err)
+			return
+		}
+		if err != nil {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't authenticate request", err)
+			return
+		}
+
+		if principal == nil {
+			if required {
+				respondUnauthorized(res, "Authentication required", nil)
+				return
+			}
+			next.ServeHTTP(res, req)
+			return
+		}
+
+		if principal.Method == authMethodSessionCookie && !cfg.checkCSRF(req, principal.SessionID) {
+			respondWithError(res, http.StatusForbidden, "Missing or invalid CSRF token", nil)
+			return
+		}
+
+		if principal.Scoped() {
+			if scope == "" {
+				respondWithError(res, http.StatusForbidden, "Scoped tokens can't be used here", nil)
+				return
+			}
+			if !slices.Contains(principal.Scopes, scope) {
+				respondWithError(res, http.StatusForbidden, "Token is missing the "+string(scope)+" scope", nil)
+				return
+			}
+		}
+
+		ctx := context.WithValue(req.Context(), principalKey{}, principal)
+		if principal.Impersonating() {
+			cfg.auditImpersonatedRequest(res, req.WithContext(ctx), principal, next)
+			return
+		}
+		next.ServeHTTP(res, req.WithContext(ctx))
+	})
+}
+
+// resolvePrincipal works out who sent the request. Anonymous requests get a
+// nil principal; credentials that don't check out wrap errInvalidCredentials.
+// An Authorization header takes precedence over a session cookie.
+func (cfg *apiConfig) resolvePrincipal(req *http.Request) (*Principal, error) {
+	if req.Header.Get("Authorization") == "" {
+		cookie, err := req.Cookie(accessTokenCookie)
+		if err != nil {
+			return nil, nil
+		}
+		principal, err := cfg.resolveAccessToken(req.Context(), cookie.Value)
+		if err != nil {
+			return nil, err
+		}
+		principal.Method = authMethodSessionCookie
+		return principal, nil
+	}
+
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidCredentials, err)
+	}
+	if auth.IsPersonalAccessToken(token) {
+		return cfg.resolvePersonalAccessToken(req.Context(), token)
+	}
+	return cfg.resolveAccessToken(req.Context(), token)
+}
+
+// resolveAccessToken also checks the token was issued at the user's current
+// token version, so bumping the version revokes it. Revoking a session bumps
+// the version too, which keeps the session itself from being looked up on
+// every request.
+func (cfg *apiConfig) resolveAccessToken(ctx context.Context, token string) (*Principal, error) {
+	claims, err := auth.ParseJWT(token, cfg.jwtKeys)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidCredentials, err)
+	}
+	userID, _ := claims.UserID()
+
+	version, err := cfg.tokenVersions.Get(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: user %s doesn't exist", errInvalidCredentials, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenVersion != version {
+		return nil, fmt.Errorf("%w: token has been revoked", errInvalidCredentials)
+	}
+
+	principal := &Principal{
+		UserID:    userID,
+		Role:      claims.Role,
+		Method:    authMethodAccessToken,
+		SessionID: claims.Session(),
+	}
+
+	if clientID, scopes, ok := claims.Client(); ok {
+		if principal.SessionID == uuid.Nil {
+			return nil, fmt.Errorf("%w: client token without a session", errInvalidCredentials)
+		}
+		principal.ClientID = clientID
+		principal.Scopes = scopes
+	}
+
+	// Impersonation tokens stop working as soon as the impersonation is
+	// ended, not only when they expire.
+	if claims.Actor != nil {
+		actorID, impersonationID, ok := claims.Impersonation()
+		if !ok {
+			return nil, fmt.Errorf("%w: malformed act claim", errInvalidCredentials)
+		}
+		impersonation, err := cfg.dbQueries.GetActiveImpersonation(ctx, impersonationID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: impersonation has ended", errInvalidCredentials)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if impersonation.AdminID != actorID || impersonation.UserID != userID {
+			return nil, fmt.Errorf("%w: token doesn't match impersonation %s", errInvalidCredentials, impersonationID)
+		}
+		principal.ActorID = actorID
+		principal.ImpersonationID = impersonationID
+	}
+
+	return principal, nil
+}
+
+func (cfg *apiConfig) resolvePersonalAccessToken(ctx context.Context, token string) (*Principal, error) {
+	pat, err := cfg.dbQueries.GetPersonalAccessTokenByHash(ctx, auth.HashToken(token, cfg.tokenHashKey))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: unknown personal access token", errInvalidCredentials)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Stored scopes were validated when the token was created. Any that have
+	// since been retired simply never match a route.
+	scopes := []auth.Scope{}
+	for _, scope := range strings.Fields(pat.Scopes) {
+		scopes = append(scopes, auth.Scope(scope))
+	}
+
+	err = cfg.dbQueries.TouchPersonalAccessToken(ctx, pat.ID)
+	if err != nil {
+		log.Printf("Error updating token %s: %s", pat.ID, err)
+	}
+
+	return &Principal{
+		UserID: pat.UserID,
+		Role:   auth.RoleUser,
+		Method: authMethodPersonalAccessToken,
+		Scopes: scopes,
+	}, nil
+}
+
+func respondUnauthorized(res http.ResponseWriter, msg string, err error) {
+	res.Header().Set("WWW-Authenticate", "Bearer")
+	respondWithError(res, http.StatusUnauthorized, msg, err)
+}
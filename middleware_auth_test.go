@@ -0,0 +1,237 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/google/uuid"
+)
+
+// sessionRows is an active session signed in to at createdAt.
+func sessionRows(sessionID, userID uuid.UUID, createdAt time.Time) *sqlmock.Rows {
+	now := time.Now().UTC()
+	return sqlmock.NewRows([]string{"id", "created_at", "updated_at", "last_used_at", "expires_at", "revoked_at", "user_agent", "ip_address", "user_id", "client_id", "scopes"}).
+		AddRow(sessionID.String(), createdAt, now, now, now.Add(time.Hour), nil, "", "", userID.String(), nil, nil)
+}
+
+func personalAccessTokenRows(userID uuid.UUID, scopes string) *sqlmock.Rows {
+	now := time.Now().UTC()
+	return sqlmock.NewRows([]string{"id", "created_at", "updated_at", "name", "token_hash", "scopes", "expires_at", "last_used_at", "revoked_at", "user_id"}).
+		AddRow(uuid.NewString(), now, now, "test", "", scopes, nil, nil, nil, userID.String())
+}
+
+func TestAuthenticate(t *testing.T) {
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	// accessToken is a token for userID's session at token version 1.
+	accessToken := func(t *testing.T, cfg *apiConfig, expiresIn time.Duration) string {
+		t.Helper()
+		token, err := auth.MakeJWT(userID, cfg.jwtKeys, expiresIn, auth.WithSessionID(sessionID), auth.WithTokenVersion(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	expectVersion := func(mock sqlmock.Sqlmock, version int32) {
+		expectQuery(mock, "GetUserTokenVersion").WithArgs(userID).
+			WillReturnRows(sqlmock.NewRows([]string{"token_version"}).AddRow(version))
+	}
+	expectPAT := func(mock sqlmock.Sqlmock, scopes string) {
+		expectQuery(mock, "GetPersonalAccessTokenByHash").WillReturnRows(personalAccessTokenRows(userID, scopes))
+		expectExec(mock, "TouchPersonalAccessToken").WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	pat, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// scope selects RequireScope instead of RequireAuth.
+		scope      auth.Scope
+		method     string
+		setup      func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request)
+		wantStatus int
+	}{
+		{
+			name:       "Missing credentials",
+			setup:      func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "Malformed Authorization header",
+			setup: func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {
+				req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "Malformed JWT",
+			setup: func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer not.a.jwt")
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "Expired JWT",
+			setup: func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+accessToken(t, cfg, -time.Minute))
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "JWT revoked by a token version bump",
+			setup: func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+accessToken(t, cfg, time.Hour))
+				expectVersion(mock, 2)
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "Valid JWT",
+			setup: func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+accessToken(t, cfg, time.Hour))
+				expectVersion(mock, 1)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Unknown personal access token",
+			setup: func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+pat)
+				expectQuery(mock, "GetPersonalAccessTokenByHash").WillReturnRows(sqlmock.NewRows(nil))
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "Personal access token on a RequireAuth route",
+			setup: func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+pat)
+				expectPAT(mock, string(auth.ScopeChirpsWrite))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:  "Personal access token missing the scope",
+			scope: auth.ScopeChirpsDelete,
+			setup: func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+pat)
+				expectPAT(mock, string(auth.ScopeChirpsWrite))
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:  "Personal access token holding the scope",
+			scope: auth.ScopeChirpsDelete,
+			setup: func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+pat)
+				expectPAT(mock, string(auth.ScopeChirpsWrite)+" "+string(auth.ScopeChirpsDelete))
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Cookie without X-CSRF-Token",
+			setup: func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: accessToken(t, cfg, time.Hour)})
+				expectVersion(mock, 1)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "Cookie with the wrong X-CSRF-Token",
+			setup: func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: accessToken(t, cfg, time.Hour)})
+				req.Header.Set(csrfHeader, cfg.csrfToken(uuid.New()))
+				expectVersion(mock, 1)
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "Cookie with X-CSRF-Token",
+			setup: func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: accessToken(t, cfg, time.Hour)})
+				req.Header.Set(csrfHeader, cfg.csrfToken(sessionID))
+				expectVersion(mock, 1)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "Cookie on a safe method without X-CSRF-Token",
+			method: http.MethodGet,
+			setup: func(t *testing.T, cfg *apiConfig, mock sqlmock.Sqlmock, req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: accessToken(t, cfg, time.Hour)})
+				expectVersion(mock, 1)
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, "/api/chirps", nil)
+			tt.setup(t, cfg, mock, req)
+
+			next := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				if requestPrincipal(req) == nil {
+					t.Error("handler reached without a principal")
+				}
+				res.WriteHeader(http.StatusOK)
+			})
+			handler := cfg.RequireAuth(next)
+			if tt.scope != "" {
+				handler = cfg.RequireScope(tt.scope, next)
+			}
+
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			if res.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", res.Code, tt.wantStatus, res.Body)
+			}
+			if res.Code == http.StatusUnauthorized && res.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestOptionalAuth(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	handler := cfg.OptionalAuth(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if _, ok := PrincipalFromContext(req.Context()); ok {
+			t.Error("anonymous request got a principal")
+		}
+		res.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+	}{
+		{name: "Anonymous", wantStatus: http.StatusOK},
+		{name: "Bad credentials", header: "Bearer not.a.jwt", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			if res.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", res.Code, tt.wantStatus)
+			}
+		})
+	}
+}
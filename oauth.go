@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/oidc"
+)
+
+const (
+	oidcStateDuration = 10 * time.Minute
+	oidcStateCookie   = "chirpy_oidc_state"
+)
+
+var (
+	errIdentityNoEmail  = errors.New("identity provider didn't return an email address")
+	errIdentityConflict = errors.New("an account with this email already exists")
+)
+
+// loadOIDCProviders reads the provider names in OIDC_PROVIDERS and, for each
+// name, OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET
+// and the optional space separated OIDC_<NAME>_SCOPES.
+func loadOIDCProviders(baseURL string) (map[string]*oidc.Provider, error) {
+	providers := map[string]*oidc.Provider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := &oidc.Provider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  baseURL + "/api/oauth/" + name + "/callback",
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+		providers[name] = provider
+	}
+	return providers, nil
+}
+
+func (cfg *apiConfig) oauthStart(res http.ResponseWriter, req *http.Request) {
+	providerName := req.PathValue("provider")
+	provider, ok := cfg.oidcProviders[providerName]
+	if !ok {
+		respondWithError(res, http.StatusNotFound, "Unknown identity provider", nil)
+		return
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't start login", err)
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't start login", err)
+		return
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't start login", err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(req.Context(), state, nonce, oidc.S256Challenge(verifier))
+	if err != nil {
+		respondWithError(res, http.StatusBadGateway, "Couldn't reach identity provider", err)
+		return
+	}
+
+	err = cfg.dbQueries.DeleteExpiredOIDCLoginStates(req.Context())
+	if err != nil {
+		log.Printf("Error deleting expired login states: %s", err)
+	}
+	err = cfg.dbQueries.CreateOIDCLoginState(req.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:    auth.HashToken(state, cfg.tokenHashKey),
+		ExpiresAt:    time.Now().UTC().Add(oidcStateDuration),
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't start login", err)
+		return
+	}
+
+	// The cookie ties the callback to the browser that started the login.
+	http.SetCookie(res, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/oauth/",
+		MaxAge:   int(oidcStateDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.baseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(res, req, authURL, http.StatusFound)
+}
+
+func (cfg *apiConfig) oauthCallback(res http.ResponseWriter, req *http.Request) {
+	providerName := req.PathValue("provider")
+	provider, ok := cfg.oidcProviders[providerName]
+	if !ok {
+		respondWithError(res, http.StatusNotFound, "Unknown identity provider", nil)
+		return
+	}
+
+	query := req.URL.Query()
+	if query.Get("error") != "" {
+		respondWithError(res, http.StatusUnauthorized, "Identity provider returned "+query.Get("error"), nil)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := req.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		respondWithError(res, http.StatusBadRequest, "Login state doesn't match", err)
+		return
+	}
+	http.SetCookie(res, &http.Cookie{
+		Name:   oidcStateCookie,
+		Path:   "/api/oauth/",
+		MaxAge: -1,
+	})
+
+	loginState, err := cfg.dbQueries.ConsumeOIDCLoginState(req.Context(), database.ConsumeOIDCLoginStateParams{
+		StateHash: auth.HashToken(state, cfg.tokenHashKey),
+		Provider:  providerName,
+	})
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Login state is invalid or expired", err)
+		return
+	}
+
+	claims, err := provider.Exchange(req.Context(), query.Get("code"), loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		respondWithError(res, http.StatusUnauthorized, "Couldn't verify identity", err)
+		return
+	}
+
+	user, err := cfg.userForIdentity(req.Context(), providerName, claims)
+	if errors.Is(err, errIdentityNoEmail) {
+		respondWithError(res, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if errors.Is(err, errIdentityConflict) {
+		respondWithError(res, http.StatusConflict, err.Error(), err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't sign in", err)
+		return
+	}
+
+	if user.TotpEnabledAt.Valid {
+		cfg.requireMFA(res, user)
+		return
+	}
+	cfg.issueSession(res, req, user)
+}
+
+// userForIdentity returns the user linked to the provider's subject. An
+// unknown subject is linked to the account with the same email only when both
+// sides have verified that address, otherwise a new account is created.
+func (cfg *apiConfig) userForIdentity(ctx context.Context, provider string, claims *oidc.Claims) (database.User, error) {
+	user, err := cfg.dbQueries.GetUserByIdentity(ctx, database.GetUserByIdentityParams{
+		Provider: provider,
+		Subject:  claims.Subject,
+	})
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	if claims.Email == "" {
+		return database.User{}, errIdentityNoEmail
+	}
+
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	user, err = qtx.GetUserByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		if !claims.EmailVerified || !user.EmailVerifiedAt.Valid {
+			return database.User{}, errIdentityConflict
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		user, err = qtx.CreateUserWithoutPassword(ctx, database.CreateUserWithoutPasswordParams{
+			Email:           claims.Email,
+			EmailVerifiedAt: sql.NullTime{Time: time.Now().UTC(), Valid: claims.EmailVerified},
+		})
+		if err != nil {
+			return database.User{}, err
+		}
+	default:
+		return database.User{}, err
+	}
+
+	_, err = qtx.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		UserID:   user.ID,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return database.User{}, err
+	}
+	log.Printf("Linked %s identity %s to user %s", provider, claims.Subject, user.ID)
+	return user, nil
+}
@@ -0,0 +1,768 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/oidc"
+	"github.com/google/uuid"
+)
+
+// Chirpy as an OAuth 2.0 authorization server for other tools. Only the
+// authorization code grant with PKCE (S256) and refresh tokens are supported.
+const (
+	oauthCodeDuration        = 5 * time.Minute
+	oauthAccessTokenDuration = time.Hour
+	oauthSessionDuration     = 60 * 24 * time.Hour
+)
+
+var scopeDescriptions = map[auth.Scope]string{
+	auth.ScopeChirpsWrite:  "Post chirps as you",
+	auth.ScopeChirpsDelete: "Delete your chirps",
+	auth.ScopeProfileWrite: "Change your email address and password",
+}
+
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+    <head>
+        <title>Authorize {{.ClientName}} - Chirpy</title>
+    </head>
+    <body>
+        <h1>Authorize {{.ClientName}}</h1>
+        <p>{{.ClientName}} wants to access your Chirpy account. It will be able to:</p>
+        <ul>
+            {{range .Scopes}}<li>{{.}}</li>
+            {{end}}
+        </ul>
+        <form method="post" action="/api/oauth2/authorize">
+            <input type="hidden" name="response_type" value="code">
+            <input type="hidden" name="client_id" value="{{.ClientID}}">
+            <input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+            <input type="hidden" name="scope" value="{{.Scope}}">
+            <input type="hidden" name="state" value="{{.State}}">
+            <input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+            <input type="hidden" name="code_challenge_method" value="S256">
+            <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+            <button type="submit" name="decision" value="allow">Allow</button>
+            <button type="submit" name="decision" value="deny">Deny</button>
+        </form>
+    </body>
+</html>
+`))
+
+// sameSitePage sends the browser on to the same URL from a page of this site.
+// The session cookies are SameSite=Strict, so a navigation started by
+// another site, such as an OAuth client, arrives without them; the one
+// this page starts carries them.
+var sameSitePage = template.Must(template.New("same-site").Parse(`<!DOCTYPE html>
+<html>
+    <head>
+        <title>Chirpy</title>
+        <meta http-equiv="refresh" content="0; url={{.}}">
+    </head>
+    <body>
+        <p><a href="{{.}}">Continue to Chirpy</a></p>
+    </body>
+</html>
+`))
+
+type OAuthClient struct {
+	ID           uuid.UUID `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	Secret       string    `json:"client_secret,omitempty"`
+}
+
+func newOAuthClient(client database.OauthClient) OAuthClient {
+	return OAuthClient{
+		ID:           client.ID,
+		CreatedAt:    client.CreatedAt,
+		Name:         client.Name,
+		RedirectURIs: strings.Fields(client.RedirectUris),
+		Scopes:       strings.Fields(client.Scopes),
+		Public:       !client.SecretHash.Valid,
+	}
+}
+
+// validRedirectURI accepts absolute https URIs, and http ones on the
+// loopback interface for tools running locally.
+func validRedirectURI(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Fragment != "" || u.Host == "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	}
+	return false
+}
+
+func (cfg *apiConfig) createOAuthClient(res http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		Public       bool     `json:"public"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if strings.TrimSpace(params.Name) == "" {
+		respondWithError(res, http.StatusBadRequest, "Client name is required", nil)
+		return
+	}
+	if len(params.RedirectURIs) == 0 {
+		respondWithError(res, http.StatusBadRequest, "At least one redirect URI is required", nil)
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if !validRedirectURI(uri) {
+			respondWithError(res, http.StatusBadRequest, fmt.Sprintf("Invalid redirect URI %q", uri), nil)
+			return
+		}
+	}
+	scopes, err := auth.ParseScopes(strings.Join(params.Scopes, " "))
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if len(scopes) == 0 {
+		respondWithError(res, http.StatusBadRequest, "At least one scope is required", nil)
+		return
+	}
+
+	secret := ""
+	secretHash := sql.NullString{}
+	if !params.Public {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't create client secret", err)
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret, cfg.tokenHashKey), Valid: true}
+	}
+
+	client, err := cfg.dbQueries.CreateOAuthClient(req.Context(), database.CreateOAuthClientParams{
+		Name:         strings.TrimSpace(params.Name),
+		SecretHash:   secretHash,
+		RedirectUris: strings.Join(params.RedirectURIs, " "),
+		Scopes:       auth.FormatScopes(scopes),
+		CreatedBy:    uuid.NullUUID{UUID: requestPrincipal(req).UserID, Valid: true},
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't create client", err)
+		return
+	}
+
+	resp := newOAuthClient(client)
+	resp.Secret = secret
+	respondWithJSON(res, http.StatusCreated, resp)
+}
+
+func (cfg *apiConfig) listOAuthClients(res http.ResponseWriter, req *http.Request) {
+	dbClients, err := cfg.dbQueries.ListOAuthClients(req.Context())
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't get clients", err)
+		return
+	}
+
+	clients := []OAuthClient{}
+	for _, client := range dbClients {
+		clients = append(clients, newOAuthClient(client))
+	}
+	respondWithJSON(res, http.StatusOK, clients)
+}
+
+// revokeOAuthClient removes a client and signs it out of every account that
+// authorized it.
+func (cfg *apiConfig) revokeOAuthClient(res http.ResponseWriter, req *http.Request) {
+	clientID, err := uuid.Parse(req.PathValue("clientID"))
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Invalid client ID", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke client", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	_, err = qtx.RevokeOAuthClient(req.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusNotFound, "Couldn't find client", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke client", err)
+		return
+	}
+
+	// Bumping the token versions of everyone signed in to the client ends
+	// the access tokens it holds; it has to happen before their sessions
+	// are revoked, while they can still be found.
+	bumped, err := qtx.BumpClientUsersTokenVersions(req.Context(), uuid.NullUUID{UUID: clientID, Valid: true})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke client", err)
+		return
+	}
+
+	err = qtx.RevokeClientSessions(req.Context(), uuid.NullUUID{UUID: clientID, Valid: true})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke client", err)
+		return
+	}
+
+	err = qtx.RevokeClientRefreshTokens(req.Context(), uuid.NullUUID{UUID: clientID, Valid: true})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke client", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke client", err)
+		return
+	}
+	for _, user := range bumped {
+		cfg.tokenVersions.Set(user.ID, user.TokenVersion)
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
+
+type authorizationRequest struct {
+	client        database.OauthClient
+	redirectURI   string
+	scopes        []auth.Scope
+	state         string
+	codeChallenge string
+}
+
+// authorizationError is an error the client is told about through its
+// redirect URI, as opposed to one that means the redirect URI can't be
+// trusted.
+type authorizationError struct {
+	code        string
+	description string
+}
+
+func (e *authorizationError) Error() string {
+	return e.code + ": " + e.description
+}
+
+// parseAuthorizationRequest validates the parameters of an authorization
+// request, read from the query string or the consent form.
+func (cfg *apiConfig) parseAuthorizationRequest(req *http.Request) (authorizationRequest, error) {
+	ar := authorizationRequest{}
+
+	clientID, err := uuid.Parse(req.FormValue("client_id"))
+	if err != nil {
+		return ar, fmt.Errorf("invalid client_id: %w", err)
+	}
+	ar.client, err = cfg.dbQueries.GetOAuthClient(req.Context(), clientID)
+	if err != nil {
+		return ar, fmt.Errorf("unknown client %s: %w", clientID, err)
+	}
+
+	// Redirect URIs must match a registered one exactly.
+	redirectURI := req.FormValue("redirect_uri")
+	registered := strings.Fields(ar.client.RedirectUris)
+	if redirectURI == "" && len(registered) == 1 {
+		redirectURI = registered[0]
+	}
+	if !slices.Contains(registered, redirectURI) {
+		return ar, fmt.Errorf("redirect_uri %q isn't registered for client %s", redirectURI, clientID)
+	}
+	ar.redirectURI = redirectURI
+	ar.state = req.FormValue("state")
+
+	if req.FormValue("response_type") != "code" {
+		return ar, &authorizationError{"unsupported_response_type", "only the code response type is supported"}
+	}
+
+	allowed, _ := auth.ParseScopes(ar.client.Scopes)
+	requested, err := auth.ParseScopes(req.FormValue("scope"))
+	if err != nil {
+		return ar, &authorizationError{"invalid_scope", err.Error()}
+	}
+	if len(requested) == 0 {
+		requested = allowed
+	}
+	for _, scope := range requested {
+		if !slices.Contains(allowed, scope) {
+			return ar, &authorizationError{"invalid_scope", fmt.Sprintf("client may not request %s", scope)}
+		}
+	}
+	ar.scopes = requested
+
+	ar.codeChallenge = req.FormValue("code_challenge")
+	if ar.codeChallenge == "" || req.FormValue("code_challenge_method") != "S256" {
+		return ar, &authorizationError{"invalid_request", "PKCE with code_challenge_method S256 is required"}
+	}
+
+	return ar, nil
+}
+
+// redirectToClient sends the browser back to the client with params added to
+// its redirect URI.
+func redirectToClient(res http.ResponseWriter, req *http.Request, ar authorizationRequest, params url.Values) {
+	u, _ := url.Parse(ar.redirectURI)
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if ar.state != "" {
+		query.Set("state", ar.state)
+	}
+	u.RawQuery = query.Encode()
+	http.Redirect(res, req, u.String(), http.StatusFound)
+}
+
+// respondAuthorizationError redirects errors the client should hear about
+// and answers the rest directly.
+func respondAuthorizationError(res http.ResponseWriter, req *http.Request, ar authorizationRequest, err error) {
+	authErr := &authorizationError{}
+	if errors.As(err, &authErr) {
+		redirectToClient(res, req, ar, url.Values{
+			"error":             {authErr.code},
+			"error_description": {authErr.description},
+		})
+		return
+	}
+	respondWithError(res, http.StatusBadRequest, "Invalid authorization request", err)
+}
+
+// authorize shows the consent page. Users who aren't signed in are sent to
+// the login page first and come back here afterwards. Arriving from the
+// client's site, signed-in users' cookies aren't sent yet, so they're sent
+// back here from this site before that's decided.
+func (cfg *apiConfig) authorize(res http.ResponseWriter, req *http.Request) {
+	ar, err := cfg.parseAuthorizationRequest(req)
+	if err != nil {
+		respondAuthorizationError(res, req, ar, err)
+		return
+	}
+
+	principal := requestPrincipal(req)
+	if principal == nil && req.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		res.Header().Set("Content-Type", "text/html; charset=utf-8")
+		res.Header().Set("Cache-Control", "no-store")
+		err = sameSitePage.Execute(res, req.URL.RequestURI())
+		if err != nil {
+			log.Printf("Error rendering same-site page: %s", err)
+		}
+		return
+	}
+	if principal == nil {
+		http.Redirect(res, req, "/app/login.html?next="+url.QueryEscape(req.URL.RequestURI()), http.StatusFound)
+		return
+	}
+	if principal.Scoped() || principal.Impersonating() {
+		respondWithError(res, http.StatusForbidden, "Sign in with your own account to authorize apps", nil)
+		return
+	}
+
+	descriptions := []string{}
+	for _, scope := range ar.scopes {
+		descriptions = append(descriptions, scopeDescriptions[scope])
+	}
+
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// The consent page must not be framed, or a click could be hijacked.
+	res.Header().Set("X-Frame-Options", "DENY")
+	res.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	err = consentPage.Execute(res, map[string]any{
+		"ClientName":    ar.client.Name,
+		"ClientID":      ar.client.ID,
+		"RedirectURI":   ar.redirectURI,
+		"Scope":         auth.FormatScopes(ar.scopes),
+		"Scopes":        descriptions,
+		"State":         ar.state,
+		"CodeChallenge": ar.codeChallenge,
+		"CSRFToken":     cfg.csrfToken(principal.SessionID),
+	})
+	if err != nil {
+		log.Printf("Error rendering consent page: %s", err)
+	}
+}
+
+// approveAuthorization handles the consent form and sends the browser back
+// to the client with an authorization code.
+func (cfg *apiConfig) approveAuthorization(res http.ResponseWriter, req *http.Request) {
+	ar, err := cfg.parseAuthorizationRequest(req)
+	if err != nil {
+		respondAuthorizationError(res, req, ar, err)
+		return
+	}
+
+	if req.PostFormValue("decision") != "allow" {
+		redirectToClient(res, req, ar, url.Values{"error": {"access_denied"}})
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't create authorization code", err)
+		return
+	}
+
+	err = cfg.dbQueries.CreateOAuthAuthorizationCode(req.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code, cfg.tokenHashKey),
+		ExpiresAt:     time.Now().UTC().Add(oauthCodeDuration),
+		RedirectUri:   ar.redirectURI,
+		Scopes:        auth.FormatScopes(ar.scopes),
+		CodeChallenge: ar.codeChallenge,
+		ClientID:      ar.client.ID,
+		UserID:        requestPrincipal(req).UserID,
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't create authorization code", err)
+		return
+	}
+
+	redirectToClient(res, req, ar, url.Values{"code": {code}})
+}
+
+func respondOAuthError(res http.ResponseWriter, code int, errCode, description string, err error) {
+	type errorResponse struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description,omitempty"`
+	}
+	if err != nil {
+		log.Println(err)
+	}
+	if code == http.StatusUnauthorized {
+		res.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	}
+	res.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(res, code, errorResponse{
+		Error:       errCode,
+		Description: description,
+	})
+}
+
+// authenticateClient identifies the client from HTTP Basic credentials or
+// client_id and client_secret form fields. Public clients only send their ID.
+func (cfg *apiConfig) authenticateClient(req *http.Request) (database.OauthClient, error) {
+	id, secret, ok := req.BasicAuth()
+	if !ok {
+		id, secret = req.PostFormValue("client_id"), req.PostFormValue("client_secret")
+	}
+
+	clientID, err := uuid.Parse(id)
+	if err != nil {
+		return database.OauthClient{}, fmt.Errorf("invalid client_id: %w", err)
+	}
+	client, err := cfg.dbQueries.GetOAuthClient(req.Context(), clientID)
+	if err != nil {
+		return database.OauthClient{}, fmt.Errorf("unknown client %s: %w", clientID, err)
+	}
+
+	if client.SecretHash.Valid {
+		hash := auth.HashToken(secret, cfg.tokenHashKey)
+		if secret == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash.String)) != 1 {
+			return database.OauthClient{}, fmt.Errorf("wrong secret for client %s", clientID)
+		}
+	}
+	return client, nil
+}
+
+// oauthToken is the token endpoint, for the authorization_code and
+// refresh_token grants.
+func (cfg *apiConfig) oauthToken(res http.ResponseWriter, req *http.Request) {
+	client, err := cfg.authenticateClient(req)
+	if err != nil {
+		respondOAuthError(res, http.StatusUnauthorized, "invalid_client", "Client authentication failed", err)
+		return
+	}
+
+	switch req.PostFormValue("grant_type") {
+	case "authorization_code":
+		cfg.exchangeAuthorizationCode(res, req, client)
+	case "refresh_token":
+		cfg.refreshClientToken(res, req, client)
+	default:
+		respondOAuthError(res, http.StatusBadRequest, "unsupported_grant_type", "", nil)
+	}
+}
+
+func (cfg *apiConfig) exchangeAuthorizationCode(res http.ResponseWriter, req *http.Request, client database.OauthClient) {
+	code, err := cfg.dbQueries.ConsumeOAuthAuthorizationCode(req.Context(), database.ConsumeOAuthAuthorizationCodeParams{
+		CodeHash: auth.HashToken(req.PostFormValue("code"), cfg.tokenHashKey),
+		ClientID: client.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondOAuthError(res, http.StatusBadRequest, "invalid_grant", "Authorization code is invalid, expired or already used", err)
+		return
+	}
+	if err != nil {
+		respondOAuthError(res, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+
+	if req.PostFormValue("redirect_uri") != code.RedirectUri {
+		respondOAuthError(res, http.StatusBadRequest, "invalid_grant", "redirect_uri doesn't match the authorization request", nil)
+		return
+	}
+	challenge := oidc.S256Challenge(req.PostFormValue("code_verifier"))
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) != 1 {
+		respondOAuthError(res, http.StatusBadRequest, "invalid_grant", "code_verifier doesn't match the code challenge", nil)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), code.UserID)
+	if err != nil {
+		respondOAuthError(res, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+	if user.SuspendedAt.Valid {
+		respondOAuthError(res, http.StatusBadRequest, "invalid_grant", "Account is suspended", nil)
+		return
+	}
+
+	session, err := cfg.dbQueries.CreateClientSession(req.Context(), database.CreateClientSessionParams{
+		ExpiresAt: time.Now().UTC().Add(oauthSessionDuration),
+		UserAgent: client.Name,
+		IpAddress: clientIP(req),
+		UserID:    user.ID,
+		ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scopes:    sql.NullString{String: code.Scopes, Valid: true},
+	})
+	if err != nil {
+		respondOAuthError(res, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondOAuthError(res, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+	_, err = cfg.dbQueries.CreateToken(req.Context(), database.CreateTokenParams{
+		TokenHash: auth.HashToken(refreshToken, cfg.tokenHashKey),
+		UserID:    user.ID,
+		ExpiresAt: session.ExpiresAt,
+		FamilyID:  session.ID,
+	})
+	if err != nil {
+		respondOAuthError(res, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+
+	cfg.respondClientTokens(res, user, session, refreshToken)
+}
+
+func (cfg *apiConfig) refreshClientToken(res http.ResponseWriter, req *http.Request, client database.OauthClient) {
+	oldToken, err := cfg.dbQueries.GetRefreshToken(req.Context(), auth.HashToken(req.PostFormValue("refresh_token"), cfg.tokenHashKey))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondOAuthError(res, http.StatusBadRequest, "invalid_grant", "Unknown refresh token", err)
+		return
+	}
+	if err != nil {
+		respondOAuthError(res, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+
+	session, err := cfg.dbQueries.GetActiveSession(req.Context(), oldToken.FamilyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondOAuthError(res, http.StatusBadRequest, "invalid_grant", "Refresh token is expired or revoked", err)
+		return
+	}
+	if err != nil {
+		respondOAuthError(res, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+	if session.ClientID.UUID != client.ID {
+		respondOAuthError(res, http.StatusBadRequest, "invalid_grant", "Refresh token was issued to another client", nil)
+		return
+	}
+	if oldToken.ReplacedBy.Valid {
+		cfg.revokeStolenFamily(req, oldToken)
+		respondOAuthError(res, http.StatusBadRequest, "invalid_grant", "Refresh token has already been used", nil)
+		return
+	}
+	if oldToken.RevokedAt.Valid || !oldToken.ExpiresAt.After(time.Now().UTC()) {
+		respondOAuthError(res, http.StatusBadRequest, "invalid_grant", "Refresh token is expired or revoked", nil)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), oldToken.UserID)
+	if err != nil {
+		respondOAuthError(res, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+	if user.SuspendedAt.Valid {
+		respondOAuthError(res, http.StatusBadRequest, "invalid_grant", "Account is suspended", nil)
+		return
+	}
+
+	refreshToken, err := cfg.rotateRefreshToken(req, oldToken)
+	if errors.Is(err, errRefreshTokenReused) {
+		respondOAuthError(res, http.StatusBadRequest, "invalid_grant", "Refresh token has already been used", nil)
+		return
+	}
+	if err != nil {
+		respondOAuthError(res, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+
+	cfg.respondClientTokens(res, user, session, refreshToken)
+}
+
+// respondClientTokens issues an access token limited to the session's scopes.
+func (cfg *apiConfig) respondClientTokens(res http.ResponseWriter, user database.User, session database.Session, refreshToken string) {
+	type tokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+
+	scopes, _ := auth.ParseScopes(session.Scopes.String)
+	accessToken, err := auth.MakeJWT(
+		user.ID,
+		cfg.jwtKeys,
+		oauthAccessTokenDuration,
+		auth.WithSessionID(session.ID),
+		auth.WithTokenVersion(user.TokenVersion),
+		auth.WithClient(session.ClientID.UUID, scopes),
+	)
+	if err != nil {
+		respondOAuthError(res, http.StatusInternalServerError, "server_error", "", err)
+		return
+	}
+
+	res.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(res, http.StatusOK, tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenDuration.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        auth.FormatScopes(scopes),
+	})
+}
+
+// clientTokenSession finds the session behind an access or refresh token
+// issued to client. Tokens of other clients are treated as unknown.
+func (cfg *apiConfig) clientTokenSession(req *http.Request, client database.OauthClient, token string) (database.Session, string, bool) {
+	if principal, err := cfg.resolveAccessToken(req.Context(), token); err == nil {
+		if principal.ClientID != client.ID {
+			return database.Session{}, "", false
+		}
+		session, err := cfg.dbQueries.GetActiveSession(req.Context(), principal.SessionID)
+		return session, "access_token", err == nil
+	}
+
+	refreshToken, err := cfg.dbQueries.GetRefreshToken(req.Context(), auth.HashToken(token, cfg.tokenHashKey))
+	if err != nil || refreshToken.RevokedAt.Valid || !refreshToken.ExpiresAt.After(time.Now().UTC()) {
+		return database.Session{}, "", false
+	}
+	session, err := cfg.dbQueries.GetActiveSession(req.Context(), refreshToken.FamilyID)
+	if err != nil || session.ClientID.UUID != client.ID {
+		return database.Session{}, "", false
+	}
+	return session, "refresh_token", true
+}
+
+// introspectToken implements RFC 7662 for the calling client's own tokens.
+func (cfg *apiConfig) introspectToken(res http.ResponseWriter, req *http.Request) {
+	type introspectionResponse struct {
+		Active    bool       `json:"active"`
+		Scope     string     `json:"scope,omitempty"`
+		ClientID  *uuid.UUID `json:"client_id,omitempty"`
+		Subject   *uuid.UUID `json:"sub,omitempty"`
+		ExpiresAt int64      `json:"exp,omitempty"`
+		IssuedAt  int64      `json:"iat,omitempty"`
+		TokenType string     `json:"token_type,omitempty"`
+	}
+
+	client, err := cfg.authenticateClient(req)
+	if err != nil {
+		respondOAuthError(res, http.StatusUnauthorized, "invalid_client", "Client authentication failed", err)
+		return
+	}
+
+	token := req.PostFormValue("token")
+	session, tokenType, ok := cfg.clientTokenSession(req, client, token)
+	if !ok {
+		respondWithJSON(res, http.StatusOK, introspectionResponse{Active: false})
+		return
+	}
+
+	resp := introspectionResponse{
+		Active:    true,
+		Scope:     session.Scopes.String,
+		ClientID:  &client.ID,
+		Subject:   &session.UserID,
+		ExpiresAt: session.ExpiresAt.Unix(),
+		IssuedAt:  session.CreatedAt.Unix(),
+		TokenType: tokenType,
+	}
+	if tokenType == "access_token" {
+		claims, err := auth.ParseJWT(token, cfg.jwtKeys)
+		if err == nil {
+			resp.ExpiresAt = claims.ExpiresAt.Unix()
+			resp.IssuedAt = claims.IssuedAt.Unix()
+		}
+	}
+	respondWithJSON(res, http.StatusOK, resp)
+}
+
+// revokeClientToken implements RFC 7009. Revoking either token of a session
+// ends the whole session, and unknown tokens are not an error.
+func (cfg *apiConfig) revokeClientToken(res http.ResponseWriter, req *http.Request) {
+	client, err := cfg.authenticateClient(req)
+	if err != nil {
+		respondOAuthError(res, http.StatusUnauthorized, "invalid_client", "Client authentication failed", err)
+		return
+	}
+
+	session, _, ok := cfg.clientTokenSession(req, client, req.PostFormValue("token"))
+	if ok {
+		err = cfg.dbQueries.RevokeSession(req.Context(), session.ID)
+		if err != nil {
+			respondOAuthError(res, http.StatusInternalServerError, "server_error", "", err)
+			return
+		}
+		_, err = cfg.dbQueries.RevokeRefreshTokenFamily(req.Context(), session.ID)
+		if err != nil {
+			respondOAuthError(res, http.StatusInternalServerError, "server_error", "", err)
+			return
+		}
+		_, err = cfg.revokeAccessTokens(req.Context(), session.UserID)
+		if err != nil {
+			respondOAuthError(res, http.StatusInternalServerError, "server_error", "", err)
+			return
+		}
+	}
+
+	res.WriteHeader(http.StatusOK)
+}
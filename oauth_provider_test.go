@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/oidc"
+	"github.com/google/uuid"
+)
+
+const testRedirectURI = "https://tool.example.com/callback"
+
+func oauthClientRows(clientID uuid.UUID, redirectURIs, scopes string) *sqlmock.Rows {
+	now := time.Now().UTC()
+	return sqlmock.NewRows([]string{"id", "created_at", "updated_at", "name", "secret_hash", "redirect_uris", "scopes", "revoked_at", "created_by"}).
+		AddRow(clientID.String(), now, now, "Tool", nil, redirectURIs, scopes, nil, nil)
+}
+
+func TestValidRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want bool
+	}{
+		{uri: "https://tool.example.com/callback", want: true},
+		{uri: "https://tool.example.com/callback?x=1", want: true},
+		{uri: "http://localhost:8080/callback", want: true},
+		{uri: "http://127.0.0.1/callback", want: true},
+		{uri: "http://[::1]:9000/callback", want: true},
+		{uri: "http://tool.example.com/callback", want: false},
+		{uri: "http://localhost.example.com/callback", want: false},
+		{uri: "https://tool.example.com/callback#token", want: false},
+		{uri: "/callback", want: false},
+		{uri: "javascript:alert(1)", want: false},
+		{uri: "custom-scheme://callback", want: false},
+		{uri: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			if got := validRedirectURI(tt.uri); got != tt.want {
+				t.Errorf("validRedirectURI(%q) = %v, want %v", tt.uri, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAuthorizationRequest(t *testing.T) {
+	clientID := uuid.New()
+	valid := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientID.String()},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"chirps:write"},
+		"state":                 {"xyz"},
+		"code_challenge":        {oidc.S256Challenge("verifier")},
+		"code_challenge_method": {"S256"},
+	}
+	with := func(key, value string) url.Values {
+		query := url.Values{}
+		for k, v := range valid {
+			query[k] = v
+		}
+		if value == "" {
+			query.Del(key)
+		} else {
+			query.Set(key, value)
+		}
+		return query
+	}
+
+	tests := []struct {
+		name         string
+		query        url.Values
+		redirectURIs string
+		clientScopes string
+		// wantCode is the error sent back to the client, or "" if the
+		// request is accepted. wantErr is for errors answered directly
+		// because the redirect URI can't be trusted.
+		wantCode   string
+		wantErr    bool
+		wantScopes string
+	}{
+		{name: "Valid", query: valid, wantScopes: "chirps:write"},
+		{name: "Scopes default to the client's", query: with("scope", ""), wantScopes: "chirps:write chirps:delete"},
+		{name: "Single redirect URI is the default", query: with("redirect_uri", ""), wantScopes: "chirps:write"},
+		{name: "Missing redirect URI with several registered", query: with("redirect_uri", ""), redirectURIs: testRedirectURI + " http://localhost/callback", wantErr: true},
+		{name: "Unregistered redirect URI", query: with("redirect_uri", "https://evil.example.com/callback"), wantErr: true},
+		{name: "Redirect URI with a different path", query: with("redirect_uri", testRedirectURI+"/other"), wantErr: true},
+		{name: "Unsupported response type", query: with("response_type", "token"), wantCode: "unsupported_response_type"},
+		{name: "Unknown scope", query: with("scope", "admin"), wantCode: "invalid_scope"},
+		{name: "Profile scope", query: with("scope", "profile:write"), clientScopes: "chirps:write profile:write", wantScopes: "profile:write"},
+		{name: "Scope the client may not request", query: with("scope", "chirps:write chirps:delete"), clientScopes: "chirps:write", wantCode: "invalid_scope"},
+		{name: "Missing code challenge", query: with("code_challenge", ""), wantCode: "invalid_request"},
+		{name: "Plain code challenge method", query: with("code_challenge_method", "plain"), wantCode: "invalid_request"},
+		{name: "Missing code challenge method", query: with("code_challenge_method", ""), wantCode: "invalid_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			redirectURIs := tt.redirectURIs
+			if redirectURIs == "" {
+				redirectURIs = testRedirectURI
+			}
+			scopes := tt.clientScopes
+			if scopes == "" {
+				scopes = "chirps:write chirps:delete"
+			}
+			expectQuery(mock, "GetOAuthClient").WithArgs(clientID).WillReturnRows(oauthClientRows(clientID, redirectURIs, scopes))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/oauth2/authorize?"+tt.query.Encode(), nil)
+			ar, err := cfg.parseAuthorizationRequest(req)
+
+			authErr := &authorizationError{}
+			isAuthErr := errors.As(err, &authErr)
+			switch {
+			case tt.wantErr:
+				if err == nil || isAuthErr {
+					t.Fatalf("parseAuthorizationRequest() error = %v, want an error answered directly", err)
+				}
+			case tt.wantCode != "":
+				if !isAuthErr || authErr.code != tt.wantCode {
+					t.Fatalf("parseAuthorizationRequest() error = %v, want %s", err, tt.wantCode)
+				}
+				if ar.redirectURI != testRedirectURI {
+					t.Errorf("redirectURI = %q, want %q", ar.redirectURI, testRedirectURI)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("parseAuthorizationRequest() error = %v", err)
+				}
+				if got := auth.FormatScopes(ar.scopes); got != tt.wantScopes {
+					t.Errorf("scopes = %q, want %q", got, tt.wantScopes)
+				}
+				if ar.redirectURI != testRedirectURI || ar.state != "xyz" {
+					t.Errorf("redirectURI = %q, state = %q", ar.redirectURI, ar.state)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAuthorizationRequestUnknownClient(t *testing.T) {
+	cfg, mock := newTestConfig(t)
+	clientID := uuid.New()
+	expectQuery(mock, "GetOAuthClient").WithArgs(clientID).WillReturnRows(sqlmock.NewRows(nil))
+
+	for _, id := range []string{clientID.String(), "not-a-uuid"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/oauth2/authorize?client_id="+id, nil)
+		_, err := cfg.parseAuthorizationRequest(req)
+		authErr := &authorizationError{}
+		if err == nil || errors.As(err, &authErr) {
+			t.Errorf("parseAuthorizationRequest(client_id=%s) error = %v, want an error answered directly", id, err)
+		}
+	}
+}
+
+func TestAuthorizeWithoutSession(t *testing.T) {
+	tests := []struct {
+		name         string
+		secFetchSite string
+		wantSameSite bool
+	}{
+		{name: "Browser without Sec-Fetch-Site", wantSameSite: false},
+		{name: "Arriving from this site", secFetchSite: "same-origin", wantSameSite: false},
+		{name: "Arriving from the client's site", secFetchSite: "cross-site", wantSameSite: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			clientID := uuid.New()
+			expectQuery(mock, "GetOAuthClient").WillReturnRows(oauthClientRows(clientID, testRedirectURI, "chirps:write"))
+
+			target := "/api/oauth2/authorize?response_type=code&client_id=" + clientID.String() + "&code_challenge=abc&code_challenge_method=S256"
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			if tt.secFetchSite != "" {
+				req.Header.Set("Sec-Fetch-Site", tt.secFetchSite)
+			}
+			res := httptest.NewRecorder()
+			cfg.authorize(res, req)
+
+			// Cross-site arrivals come back from a page of this site, which
+			// sends the SameSite=Strict cookies, before being asked to sign in.
+			if tt.wantSameSite {
+				if res.Code != http.StatusOK {
+					t.Fatalf("status = %d, want %d", res.Code, http.StatusOK)
+				}
+				if want := `url=` + strings.ReplaceAll(target, "&", "&amp;"); !strings.Contains(res.Body.String(), want) {
+					t.Errorf("page doesn't send the browser back to %q: %s", target, res.Body)
+				}
+				return
+			}
+			if res.Code != http.StatusFound {
+				t.Fatalf("status = %d, want %d", res.Code, http.StatusFound)
+			}
+			if got, want := res.Header().Get("Location"), "/app/login.html?next="+url.QueryEscape(target); got != want {
+				t.Errorf("Location = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestExchangeAuthorizationCode(t *testing.T) {
+	verifier := "a-long-random-code-verifier"
+	clientID := uuid.New()
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name         string
+		codeFound    bool
+		redirectURI  string
+		codeVerifier string
+		wantStatus   int
+		wantError    string
+	}{
+		{name: "Valid", codeFound: true, redirectURI: testRedirectURI, codeVerifier: verifier, wantStatus: http.StatusOK},
+		{name: "Unknown or used code", redirectURI: testRedirectURI, codeVerifier: verifier, wantStatus: http.StatusBadRequest, wantError: "invalid_grant"},
+		{name: "Wrong redirect URI", codeFound: true, redirectURI: "https://evil.example.com/callback", codeVerifier: verifier, wantStatus: http.StatusBadRequest, wantError: "invalid_grant"},
+		{name: "Wrong code verifier", codeFound: true, redirectURI: testRedirectURI, codeVerifier: "another-verifier", wantStatus: http.StatusBadRequest, wantError: "invalid_grant"},
+		{name: "Missing code verifier", codeFound: true, redirectURI: testRedirectURI, wantStatus: http.StatusBadRequest, wantError: "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			now := time.Now().UTC()
+
+			codeRows := sqlmock.NewRows([]string{"code_hash", "created_at", "expires_at", "used_at", "redirect_uri", "scopes", "code_challenge", "client_id", "user_id"})
+			if tt.codeFound {
+				codeRows.AddRow("", now, now.Add(oauthCodeDuration), now, testRedirectURI, "chirps:write", oidc.S256Challenge(verifier), clientID.String(), userID.String())
+			}
+			expectQuery(mock, "ConsumeOAuthAuthorizationCode").
+				WithArgs(auth.HashToken("the-code", cfg.tokenHashKey), clientID).
+				WillReturnRows(codeRows)
+			if tt.wantStatus == http.StatusOK {
+				user := testUser()
+				user.ID = userID
+				expectQuery(mock, "GetUserByID").WithArgs(userID).WillReturnRows(userRows(user))
+				expectQuery(mock, "CreateClientSession").WillReturnRows(
+					sqlmock.NewRows([]string{"id", "created_at", "updated_at", "last_used_at", "expires_at", "revoked_at", "user_agent", "ip_address", "user_id", "client_id", "scopes"}).
+						AddRow(sessionID.String(), now, now, now, now.Add(oauthSessionDuration), nil, "Tool", "", userID.String(), clientID.String(), "chirps:write"))
+				expectQuery(mock, "CreateToken").WillReturnRows(
+					sqlmock.NewRows([]string{"token_hash", "created_at", "updated_at", "expires_at", "revoked_at", "user_id", "family_id", "replaced_by"}).
+						AddRow("", now, now, now.Add(oauthSessionDuration), nil, userID.String(), sessionID.String(), nil))
+			}
+
+			form := url.Values{
+				"grant_type":   {"authorization_code"},
+				"code":         {"the-code"},
+				"redirect_uri": {tt.redirectURI},
+			}
+			if tt.codeVerifier != "" {
+				form.Set("code_verifier", tt.codeVerifier)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/oauth2/token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			res := httptest.NewRecorder()
+			cfg.exchangeAuthorizationCode(res, req, database.OauthClient{ID: clientID, Name: "Tool"})
+
+			if res.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", res.Code, tt.wantStatus, res.Body)
+			}
+			body := struct {
+				Error       string `json:"error"`
+				AccessToken string `json:"access_token"`
+				Scope       string `json:"scope"`
+			}{}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", body.Error, tt.wantError)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			claims, err := auth.ParseJWT(body.AccessToken, cfg.jwtKeys)
+			if err != nil {
+				t.Fatalf("ParseJWT() error = %v", err)
+			}
+			gotClient, scopes, ok := claims.Client()
+			if !ok || gotClient != clientID || auth.FormatScopes(scopes) != "chirps:write" || claims.Session() != sessionID {
+				t.Errorf("token client = %s, scopes = %v, session = %s", gotClient, scopes, claims.Session())
+			}
+			if body.Scope != "chirps:write" {
+				t.Errorf("scope = %q, want %q", body.Scope, "chirps:write")
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/mailer"
+	"github.com/Wolfy-22/Chirpy.git/internal/workpool"
+)
+
+const passwordResetDuration = time.Hour
+
+func (cfg *apiConfig) requestPasswordReset(res http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	// The response is the same whether or not the account exists, and so is
+	// the time it takes: creating the token and sending the mail happen after
+	// responding.
+	user, err := cfg.dbQueries.GetUserByEmail(req.Context(), params.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		res.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't get user", err)
+		return
+	}
+
+	go cfg.sendPasswordResetEmail(user)
+
+	res.WriteHeader(http.StatusAccepted)
+}
+
+func (cfg *apiConfig) sendPasswordResetEmail(user database.User) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("Error creating reset token for user %s: %s", user.ID, err)
+		return
+	}
+
+	err = cfg.dbQueries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token, cfg.tokenHashKey),
+		ExpiresAt: time.Now().UTC().Add(passwordResetDuration),
+		UserID:    user.ID,
+	})
+	if err != nil {
+		log.Printf("Error creating reset token for user %s: %s", user.ID, err)
+		return
+	}
+
+	cfg.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: fmt.Sprintf("Someone asked to reset the password for your Chirpy account.\n\n"+
+			"Open this link within the next hour to choose a new one:\n%s\n\n"+
+			"If it wasn't you, you can ignore this email.\n",
+			cfg.baseURL+"/app/reset-password.html?token="+url.QueryEscape(token)),
+	})
+}
+
+func (cfg *apiConfig) confirmPasswordReset(res http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	tokenHash := auth.HashToken(params.Token, cfg.tokenHashKey)
+
+	// Look the token up without using it so a password that breaks the
+	// policy can be corrected and submitted again.
+	activeToken, err := cfg.dbQueries.GetActivePasswordResetToken(req.Context(), tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusBadRequest, "Reset token is invalid or expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(req.Context(), activeToken.UserID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	if !cfg.checkPasswordPolicy(res, params.Password, user.Email) {
+		return
+	}
+
+	hashedPassword, err := cfg.hashPassword(req.Context(), params.Password)
+	if errors.Is(err, workpool.ErrSaturated) {
+		cfg.respondPasswordPoolBusy(res)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't hash password", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(req.Context(), nil)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	resetToken, err := qtx.ConsumePasswordResetToken(req.Context(), tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusBadRequest, "Reset token is invalid or expired", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	err = qtx.UpdateUserPassword(req.Context(), database.UpdateUserPasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             resetToken.UserID,
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	err = qtx.DeletePasswordResetTokensByUserID(req.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	err = qtx.RevokeAllSessions(req.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	err = qtx.RevokeAllRefreshTokens(req.Context(), resetToken.UserID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't reset password", err)
+		return
+	}
+
+	cfg.tokenVersions.Forget(resetToken.UserID)
+
+	log.Printf("Password reset for user %s", resetToken.UserID)
+	res.WriteHeader(http.StatusNoContent)
+}
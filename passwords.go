@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/passwordpolicy"
+	"github.com/Wolfy-22/Chirpy.git/internal/workpool"
+	"github.com/alexedwards/argon2id"
+)
+
+// loadPasswordParams reads the argon2id cost from ARGON2_MEMORY_KIB,
+// ARGON2_ITERATIONS and ARGON2_PARALLELISM, falling back to the library
+// defaults for any that are unset.
+func loadPasswordParams() (*argon2id.Params, error) {
+	params := *argon2id.DefaultParams
+
+	memory, err := positiveEnv("ARGON2_MEMORY_KIB", 32)
+	if err != nil {
+		return nil, err
+	}
+	if memory > 0 {
+		params.Memory = uint32(memory)
+	}
+
+	iterations, err := positiveEnv("ARGON2_ITERATIONS", 32)
+	if err != nil {
+		return nil, err
+	}
+	if iterations > 0 {
+		params.Iterations = uint32(iterations)
+	}
+
+	parallelism, err := positiveEnv("ARGON2_PARALLELISM", 8)
+	if err != nil {
+		return nil, err
+	}
+	if parallelism > 0 {
+		params.Parallelism = uint8(parallelism)
+	}
+
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return nil, errors.New("ARGON2_MEMORY_KIB must be at least 8 KiB per unit of parallelism")
+	}
+	return &params, nil
+}
+
+// positiveEnv parses an optional positive integer setting, returning 0 when
+// it is unset.
+func positiveEnv(name string, bitSize int) (uint64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return n, nil
+}
+
+// loadPasswordPool bounds how many argon2id hashes run at once, each of
+// which holds ARGON2_MEMORY_KIB of memory. PASSWORD_HASH_CONCURRENCY defaults
+// to the number of CPUs and PASSWORD_HASH_QUEUE_TIMEOUT to 5s.
+func loadPasswordPool() (*workpool.Pool, error) {
+	concurrency, err := positiveEnv("PASSWORD_HASH_CONCURRENCY", 16)
+	if err != nil {
+		return nil, err
+	}
+	if concurrency == 0 {
+		concurrency = uint64(runtime.NumCPU())
+	}
+
+	queueTimeout := 5 * time.Second
+	if value := os.Getenv("PASSWORD_HASH_QUEUE_TIMEOUT"); value != "" {
+		queueTimeout, err = time.ParseDuration(value)
+		if err != nil || queueTimeout <= 0 {
+			return nil, errors.New("PASSWORD_HASH_QUEUE_TIMEOUT must be a positive duration")
+		}
+	}
+
+	return workpool.New(int(concurrency), queueTimeout), nil
+}
+
+func (cfg *apiConfig) hashPassword(ctx context.Context, password string) (string, error) {
+	var hash string
+	var hashErr error
+	err := cfg.passwordPool.Do(ctx, func() {
+		hash, hashErr = auth.HashPassword(password)
+	})
+	if err != nil {
+		return "", err
+	}
+	return hash, hashErr
+}
+
+// unsetPasswordHash is the column default for accounts created through OIDC
+// sign-in, which never had a password. Magic links only sign in to existing
+// accounts.
+const unsetPasswordHash = "unset"
+
+func hasPassword(user database.User) bool {
+	return user.HashedPassword != "" && user.HashedPassword != unsetPasswordHash
+}
+
+func (cfg *apiConfig) checkPassword(ctx context.Context, password, hash string) (bool, error) {
+	var match bool
+	var checkErr error
+	err := cfg.passwordPool.Do(ctx, func() {
+		match, checkErr = auth.CheckPasswordHash(password, hash)
+	})
+	if err != nil {
+		return false, err
+	}
+	return match, checkErr
+}
+
+// respondPasswordPoolBusy tells the client to back off when no hashing slot
+// freed up in time.
+func (cfg *apiConfig) respondPasswordPoolBusy(res http.ResponseWriter) {
+	retryAfter := int(math.Ceil(cfg.passwordPool.QueueTimeout().Seconds()))
+	res.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	respondWithError(res, http.StatusServiceUnavailable, "Server is busy, try again later", workpool.ErrSaturated)
+}
+
+func (cfg *apiConfig) passwordPoolMetrics(res http.ResponseWriter, req *http.Request) {
+	type metricsResponse struct {
+		Concurrency      int     `json:"concurrency"`
+		Running          int64   `json:"running"`
+		QueueDepth       int64   `json:"queue_depth"`
+		Completed        int64   `json:"completed_total"`
+		Rejected         int64   `json:"rejected_total"`
+		WaitSecondsTotal float64 `json:"wait_seconds_total"`
+		WaitSecondsMax   float64 `json:"wait_seconds_max"`
+	}
+
+	stats := cfg.passwordPool.Stats()
+	respondWithJSON(res, http.StatusOK, metricsResponse{
+		Concurrency:      stats.Size,
+		Running:          stats.Running,
+		QueueDepth:       stats.Queued,
+		Completed:        stats.Completed,
+		Rejected:         stats.Rejected,
+		WaitSecondsTotal: stats.WaitTotal.Seconds(),
+		WaitSecondsMax:   stats.WaitMax.Seconds(),
+	})
+}
+
+// loadPasswordPolicy reads PASSWORD_MIN_LENGTH (default 8),
+// PASSWORD_MAX_LENGTH (default 128) and BREACHED_PASSWORDS_FILE, an optional
+// list of SHA-1 hashes of breached passwords.
+func loadPasswordPolicy() (passwordpolicy.Policy, error) {
+	policy := passwordpolicy.Policy{
+		MinLength: 8,
+		MaxLength: 128,
+	}
+
+	minLength, err := positiveEnv("PASSWORD_MIN_LENGTH", 16)
+	if err != nil {
+		return policy, err
+	}
+	if minLength > 0 {
+		policy.MinLength = int(minLength)
+	}
+
+	maxLength, err := positiveEnv("PASSWORD_MAX_LENGTH", 16)
+	if err != nil {
+		return policy, err
+	}
+	if maxLength > 0 {
+		policy.MaxLength = int(maxLength)
+	}
+
+	if policy.MinLength > policy.MaxLength {
+		return policy, errors.New("PASSWORD_MIN_LENGTH can't be more than PASSWORD_MAX_LENGTH")
+	}
+
+	path := os.Getenv("BREACHED_PASSWORDS_FILE")
+	if path != "" {
+		policy.Breached, err = passwordpolicy.LoadBreachedList(path)
+		if err != nil {
+			return policy, err
+		}
+		log.Printf("Loaded %d breached password hashes", policy.Breached.Len())
+	}
+
+	return policy, nil
+}
+
+// checkPasswordPolicy responds with every rule a new password breaks at
+// once, so clients can show them together, and returns false.
+func (cfg *apiConfig) checkPasswordPolicy(res http.ResponseWriter, password string, emails ...string) bool {
+	type policyResponse struct {
+		Error      string                     `json:"error"`
+		Violations []passwordpolicy.Violation `json:"violations"`
+	}
+
+	violations := cfg.passwordPolicy.Validate(password, emails...)
+	if len(violations) == 0 {
+		return true
+	}
+
+	respondWithJSON(res, http.StatusBadRequest, policyResponse{
+		Error:      "Password doesn't meet the requirements",
+		Violations: violations,
+	})
+	return false
+}
+
+// upgradePasswordHash replaces a hash made with weaker parameters while the
+// plaintext password is at hand after a successful login. Failures are only
+// logged since the old hash keeps working.
+func (cfg *apiConfig) upgradePasswordHash(ctx context.Context, user database.User, password string) {
+	rehash, err := auth.NeedsRehash(user.HashedPassword)
+	if err != nil {
+		log.Printf("Error checking password hash of user %s: %s", user.ID, err)
+		return
+	}
+	if !rehash {
+		return
+	}
+
+	hash, err := cfg.hashPassword(ctx, password)
+	if err != nil {
+		log.Printf("Error rehashing password of user %s: %s", user.ID, err)
+		return
+	}
+
+	// Matching on the old hash keeps a password changed in the meantime from
+	// being overwritten.
+	err = cfg.dbQueries.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+		NewHash: hash,
+		ID:      user.ID,
+		OldHash: user.HashedPassword,
+	})
+	if err != nil {
+		log.Printf("Error saving rehashed password of user %s: %s", user.ID, err)
+	}
+}
+
+// passwordHashReport shows how many users still have hashes made with
+// parameters weaker than the current ones, i.e. haven't logged in since the
+// cost was raised.
+func (cfg *apiConfig) passwordHashReport(res http.ResponseWriter, req *http.Request) {
+	type paramsCount struct {
+		Params   string `json:"params"`
+		Users    int64  `json:"users"`
+		Outdated bool   `json:"outdated"`
+	}
+	type reportResponse struct {
+		Current  string        `json:"current"`
+		Users    int64         `json:"users"`
+		Outdated int64         `json:"outdated"`
+		ByParams []paramsCount `json:"by_params"`
+	}
+
+	rows, err := cfg.dbQueries.CountUsersByPasswordParams(req.Context())
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't count password hashes", err)
+		return
+	}
+
+	current := auth.PasswordParams()
+	report := reportResponse{
+		Current:  formatPasswordParams(current),
+		ByParams: []paramsCount{},
+	}
+	for _, row := range rows {
+		params := current
+		_, err := fmt.Sscanf(row.Params, "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+		outdated := err != nil || auth.WeakerPasswordParams(&params)
+
+		report.Users += row.Users
+		if outdated {
+			report.Outdated += row.Users
+		}
+		report.ByParams = append(report.ByParams, paramsCount{
+			Params:   row.Params,
+			Users:    row.Users,
+			Outdated: outdated,
+		})
+	}
+
+	respondWithJSON(res, http.StatusOK, report)
+}
+
+func formatPasswordParams(params argon2id.Params) string {
+	return fmt.Sprintf("m=%d,t=%d,p=%d", params.Memory, params.Iterations, params.Parallelism)
+}
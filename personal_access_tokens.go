@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/google/uuid"
+)
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func newPersonalAccessToken(pat database.PersonalAccessToken) PersonalAccessToken {
+	resp := PersonalAccessToken{
+		ID:        pat.ID,
+		CreatedAt: pat.CreatedAt,
+		Name:      pat.Name,
+		Scopes:    strings.Fields(pat.Scopes),
+	}
+	if pat.ExpiresAt.Valid {
+		resp.ExpiresAt = &pat.ExpiresAt.Time
+	}
+	if pat.LastUsedAt.Valid {
+		resp.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	return resp
+}
+
+func (cfg *apiConfig) createPersonalAccessToken(res http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+
+	userID := requestPrincipal(req).UserID
+
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if strings.TrimSpace(params.Name) == "" {
+		respondWithError(res, http.StatusBadRequest, "Token name is required", nil)
+		return
+	}
+	scopes, err := auth.ParseScopes(strings.Join(params.Scopes, " "))
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if len(scopes) == 0 {
+		respondWithError(res, http.StatusBadRequest, "At least one scope is required", nil)
+		return
+	}
+	if params.ExpiresInDays < 0 {
+		respondWithError(res, http.StatusBadRequest, "expires_in_days can't be negative", nil)
+		return
+	}
+
+	expiresAt := sql.NullTime{}
+	if params.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{Time: time.Now().UTC().AddDate(0, 0, params.ExpiresInDays), Valid: true}
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+
+	pat, err := cfg.dbQueries.CreatePersonalAccessToken(req.Context(), database.CreatePersonalAccessTokenParams{
+		Name:      strings.TrimSpace(params.Name),
+		TokenHash: auth.HashToken(token, cfg.tokenHashKey),
+		Scopes:    auth.FormatScopes(scopes),
+		ExpiresAt: expiresAt,
+		UserID:    userID,
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't create token", err)
+		return
+	}
+
+	resp := newPersonalAccessToken(pat)
+	resp.Token = token
+	respondWithJSON(res, http.StatusCreated, resp)
+}
+
+func (cfg *apiConfig) listPersonalAccessTokens(res http.ResponseWriter, req *http.Request) {
+	userID := requestPrincipal(req).UserID
+
+	pats, err := cfg.dbQueries.GetPersonalAccessTokensByUserID(req.Context(), userID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't get tokens", err)
+		return
+	}
+
+	tokens := []PersonalAccessToken{}
+	for _, pat := range pats {
+		tokens = append(tokens, newPersonalAccessToken(pat))
+	}
+	respondWithJSON(res, http.StatusOK, tokens)
+}
+
+func (cfg *apiConfig) revokePersonalAccessToken(res http.ResponseWriter, req *http.Request) {
+	tokenID, err := uuid.Parse(req.PathValue("tokenID"))
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Invalid token ID", err)
+		return
+	}
+
+	userID := requestPrincipal(req).UserID
+
+	_, err = cfg.dbQueries.RevokePersonalAccessToken(req.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusNotFound, "Couldn't find token", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke token", err)
+		return
+	}
+
+	res.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/webhook"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPolkaWebhookTolerance = 5 * time.Minute
+	maxPolkaWebhookBody          = 1 << 20
+	// webhookEventLease is how long an event may stay pending before it is
+	// assumed to have been abandoned, say by a crash, and may be claimed
+	// again.
+	webhookEventLease = 2 * time.Minute
+)
+
+// loadPolkaVerifier reads POLKA_WEBHOOK_SECRETS, a comma separated list of at
+// most two secrets so the old one keeps working while Polka switches to the
+// new one, and POLKA_WEBHOOK_TOLERANCE, how far the signed timestamp may be
+// from our clock.
+func loadPolkaVerifier() (*webhook.Verifier, error) {
+	secrets := [][]byte{}
+	for _, secret := range strings.Split(os.Getenv("POLKA_WEBHOOK_SECRETS"), ",") {
+		secret = strings.TrimSpace(secret)
+		if secret != "" {
+			secrets = append(secrets, []byte(secret))
+		}
+	}
+	if len(secrets) > 2 {
+		return nil, errors.New("POLKA_WEBHOOK_SECRETS takes at most two secrets")
+	}
+	if len(secrets) == 0 {
+		log.Printf("POLKA_WEBHOOK_SECRETS isn't set, Polka webhooks will be rejected")
+	}
+
+	tolerance := defaultPolkaWebhookTolerance
+	if value := os.Getenv("POLKA_WEBHOOK_TOLERANCE"); value != "" {
+		var err error
+		tolerance, err = time.ParseDuration(value)
+		if err != nil || tolerance <= 0 {
+			return nil, errors.New("POLKA_WEBHOOK_TOLERANCE must be a positive duration")
+		}
+	}
+
+	return webhook.NewVerifier(secrets, tolerance), nil
+}
+
+// verifyPolkaWebhook reads the body of a webhook and checks its signature.
+// It returns the delivery's replay key, which is the same however many
+// signatures the delivery carries. A delivery is rejected once it has been
+// processed successfully; receivePolkaWebhook records it then, so a delivery
+// that failed can still be retried. It is remembered for as long as its
+// timestamp is within the tolerance, after which the timestamp check
+// rejects it anyway.
+func (cfg *apiConfig) verifyPolkaWebhook(res http.ResponseWriter, req *http.Request) ([]byte, string, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(res, req.Body, maxPolkaWebhookBody))
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't read body", err)
+		return nil, "", false
+	}
+
+	replayKey, err := cfg.polkaWebhooks.Verify(req.Header, body)
+	if err != nil {
+		respondWithError(res, http.StatusUnauthorized, "Invalid webhook signature", err)
+		return nil, "", false
+	}
+
+	err = cfg.dbQueries.DeleteExpiredWebhookSignatures(req.Context())
+	if err != nil {
+		log.Printf("Error deleting expired webhook signatures: %s", err)
+	}
+
+	recorded, err := cfg.dbQueries.WebhookSignatureRecorded(req.Context(), replayKey)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't record webhook", err)
+		return nil, "", false
+	}
+	if recorded {
+		respondWithError(res, http.StatusUnauthorized, "Webhook delivery was already received", nil)
+		return nil, "", false
+	}
+
+	return body, replayKey, true
+}
+
+// recordPolkaDelivery remembers a delivery that was processed so it isn't
+// accepted again. The event is done either way, so failing to remember it
+// is only logged.
+func (cfg *apiConfig) recordPolkaDelivery(ctx context.Context, replayKey string) {
+	_, err := cfg.dbQueries.RecordWebhookSignature(ctx, database.RecordWebhookSignatureParams{
+		ReplayKey: replayKey,
+		ExpiresAt: time.Now().UTC().Add(2 * cfg.polkaWebhooks.Tolerance),
+	})
+	if err != nil {
+		log.Printf("Error recording webhook delivery: %s", err)
+	}
+}
+
+const (
+	webhookStatusPending   = "pending"
+	webhookStatusProcessed = "processed"
+	webhookStatusIgnored   = "ignored"
+	webhookStatusFailed    = "failed"
+)
+
+type WebhookEvent struct {
+	ID          uuid.UUID       `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	EventID     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int32           `json:"attempts"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+}
+
+func newWebhookEvent(event database.WebhookEvent) WebhookEvent {
+	resp := WebhookEvent{
+		ID:        event.ID,
+		CreatedAt: event.CreatedAt,
+		UpdatedAt: event.UpdatedAt,
+		EventID:   event.EventID,
+		EventType: event.EventType,
+		Payload:   event.Payload,
+		Status:    event.Status,
+		Error:     event.Error.String,
+		Attempts:  event.Attempts,
+	}
+	if event.ProcessedAt.Valid {
+		resp.ProcessedAt = &event.ProcessedAt.Time
+	}
+	return resp
+}
+
+func (cfg *apiConfig) registerPolkaHandlers() {
+	cfg.polkaEvents = webhook.NewRegistry()
+	cfg.polkaEvents.Handle("user.upgraded", cfg.startSubscription)
+	cfg.polkaEvents.Handle("subscription.renewed", cfg.renewSubscription)
+	cfg.polkaEvents.Handle("user.downgraded", cfg.cancelSubscription)
+	cfg.polkaEvents.Handle("subscription.refunded", cfg.refundSubscription)
+}
+
+// receivePolkaWebhook logs every event before processing it. Polka retries
+// deliveries we don't answer with a 2xx, so an event ID seen before is
+// processed again if it failed last time or was abandoned while pending.
+func (cfg *apiConfig) receivePolkaWebhook(res http.ResponseWriter, req *http.Request) {
+	type payload struct {
+		ID    string `json:"id"`
+		Event string `json:"event"`
+	}
+
+	body, replayKey, ok := cfg.verifyPolkaWebhook(res, req)
+	if !ok {
+		return
+	}
+
+	params := payload{}
+	err := json.Unmarshal(body, &params)
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.ID == "" || params.Event == "" {
+		respondWithError(res, http.StatusBadRequest, "Webhook is missing its id or event", nil)
+		return
+	}
+
+	event, err := cfg.dbQueries.CreateWebhookEvent(req.Context(), database.CreateWebhookEventParams{
+		EventID:   params.ID,
+		EventType: params.Event,
+		Payload:   body,
+		Status:    webhookStatusPending,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		event, err = cfg.dbQueries.GetWebhookEventByEventID(req.Context(), params.ID)
+		if err != nil {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't record webhook", err)
+			return
+		}
+		if event.Status == webhookStatusProcessed || event.Status == webhookStatusIgnored {
+			cfg.recordPolkaDelivery(req.Context(), replayKey)
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+		event, err = cfg.claimWebhookEvent(req.Context(), event.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Another delivery is still working on it. Polka retries
+			// later and learns the outcome then.
+			res.Header().Set("Retry-After", strconv.Itoa(int(webhookEventLease.Seconds())))
+			respondWithError(res, http.StatusConflict, "Webhook is already being processed", nil)
+			return
+		}
+		if err != nil {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't record webhook", err)
+			return
+		}
+	} else if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't record webhook", err)
+		return
+	}
+
+	event, err = cfg.processWebhookEvent(req.Context(), event)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't record webhook", err)
+		return
+	}
+	if event.Status == webhookStatusFailed {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't process webhook", nil)
+		return
+	}
+
+	cfg.recordPolkaDelivery(req.Context(), replayKey)
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// claimWebhookEvent marks a failed event, or one left pending for longer than
+// the lease, as pending again for the caller to process. It returns
+// sql.ErrNoRows when the event can't be claimed.
+func (cfg *apiConfig) claimWebhookEvent(ctx context.Context, id uuid.UUID) (database.WebhookEvent, error) {
+	return cfg.dbQueries.ClaimWebhookEvent(ctx, database.ClaimWebhookEventParams{
+		ID:          id,
+		StaleBefore: time.Now().UTC().Add(-webhookEventLease),
+	})
+}
+
+// processWebhookEvent dispatches an event to the handler for its type and
+// records the outcome on it. The returned error is only set when the
+// outcome couldn't be saved; a failing handler shows up in the status.
+func (cfg *apiConfig) processWebhookEvent(ctx context.Context, event database.WebhookEvent) (database.WebhookEvent, error) {
+	payload := struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+	err := json.Unmarshal(event.Payload, &payload)
+	if err == nil {
+		var finished database.WebhookEvent
+		finished, err = cfg.applyWebhookEvent(ctx, event, payload.Data)
+		if err == nil {
+			return finished, nil
+		}
+	}
+
+	// Nothing the handler did was kept, so the event can be processed again.
+	// The failure is saved even if the request was canceled meanwhile.
+	log.Printf("Webhook event %s (%s) failed: %s", event.EventID, event.EventType, err)
+	return cfg.dbQueries.FinishWebhookEvent(context.WithoutCancel(ctx), database.FinishWebhookEventParams{
+		Status: webhookStatusFailed,
+		Error:  sql.NullString{String: err.Error(), Valid: true},
+		ID:     event.ID,
+	})
+}
+
+type (
+	webhookQueriesKey struct{}
+	webhookEventIDKey struct{}
+)
+
+// applyWebhookEvent runs the handler and marks the event processed in one
+// transaction, so an event is never applied without being marked or marked
+// without being applied. Handlers make their changes through
+// webhookQueries to take part in it.
+func (cfg *apiConfig) applyWebhookEvent(ctx context.Context, event database.WebhookEvent, data json.RawMessage) (database.WebhookEvent, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.WebhookEvent{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+
+	handlerCtx := context.WithValue(ctx, webhookQueriesKey{}, qtx)
+	handlerCtx = context.WithValue(handlerCtx, webhookEventIDKey{}, event.EventID)
+
+	status := webhookStatusProcessed
+	err = cfg.polkaEvents.Dispatch(handlerCtx, event.EventType, data)
+	if errors.Is(err, webhook.ErrNoHandler) {
+		status = webhookStatusIgnored
+	} else if err != nil {
+		return database.WebhookEvent{}, err
+	}
+
+	finished, err := qtx.FinishWebhookEvent(ctx, database.FinishWebhookEventParams{
+		Status: status,
+		ID:     event.ID,
+	})
+	if err != nil {
+		return database.WebhookEvent{}, err
+	}
+	return finished, tx.Commit()
+}
+
+// webhookEventID returns the ID Polka gave the event being applied, for
+// handlers that have to recognize an event they already applied.
+func webhookEventID(ctx context.Context) sql.NullString {
+	eventID, ok := ctx.Value(webhookEventIDKey{}).(string)
+	return sql.NullString{String: eventID, Valid: ok}
+}
+
+// webhookQueries returns the queries of the transaction a webhook event is
+// being applied in, or the plain ones outside of one.
+func (cfg *apiConfig) webhookQueries(ctx context.Context) *database.Queries {
+	if qtx, ok := ctx.Value(webhookQueriesKey{}).(*database.Queries); ok {
+		return qtx
+	}
+	return cfg.dbQueries
+}
+
+func (cfg *apiConfig) listWebhookEvents(res http.ResponseWriter, req *http.Request) {
+	status := sql.NullString{}
+	if value := req.URL.Query().Get("status"); value != "" {
+		status = sql.NullString{String: value, Valid: true}
+	}
+
+	limit := 50
+	if value := req.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 500 {
+			respondWithError(res, http.StatusBadRequest, "limit must be between 1 and 500", err)
+			return
+		}
+		limit = n
+	}
+
+	dbEvents, err := cfg.dbQueries.ListWebhookEvents(req.Context(), database.ListWebhookEventsParams{
+		Status:    status,
+		MaxEvents: int32(limit),
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't get webhook events", err)
+		return
+	}
+
+	events := []WebhookEvent{}
+	for _, event := range dbEvents {
+		events = append(events, newWebhookEvent(event))
+	}
+	respondWithJSON(res, http.StatusOK, events)
+}
+
+func (cfg *apiConfig) replayWebhookEvent(res http.ResponseWriter, req *http.Request) {
+	id, err := uuid.Parse(req.PathValue("eventID"))
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Invalid event ID", err)
+		return
+	}
+
+	event, err := cfg.dbQueries.GetWebhookEvent(req.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusNotFound, "Couldn't find webhook event", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't get webhook event", err)
+		return
+	}
+
+	event, err = cfg.claimWebhookEvent(req.Context(), event.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusConflict, "Only failed or stalled webhook events can be replayed", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't get webhook event", err)
+		return
+	}
+
+	event, err = cfg.processWebhookEvent(req.Context(), event)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't record webhook", err)
+		return
+	}
+	log.Printf("Webhook event %s replayed: %s", event.EventID, event.Status)
+
+	respondWithJSON(res, http.StatusOK, newWebhookEvent(event))
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/Wolfy-22/Chirpy.git/internal/webhook"
+	"github.com/google/uuid"
+)
+
+var testPolkaSecret = []byte("polka-secret")
+
+func webhookEventRows(events ...database.WebhookEvent) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "event_id", "event_type", "payload", "status", "error", "attempts", "processed_at"})
+	for _, e := range events {
+		rows.AddRow(e.ID.String(), e.CreatedAt, e.UpdatedAt, e.EventID, e.EventType, []byte(e.Payload), e.Status, nil, e.Attempts, nil)
+	}
+	return rows
+}
+
+// newPolkaTestConfig registers a single user.upgraded handler that fails
+// with handlerErr and counts its calls. It checks it is handed the queries
+// of the transaction the event is finished in.
+func newPolkaTestConfig(t *testing.T, handlerErr error) (*apiConfig, sqlmock.Sqlmock, *int) {
+	cfg, mock := newTestConfig(t)
+	cfg.polkaWebhooks = webhook.NewVerifier([][]byte{testPolkaSecret}, 5*time.Minute)
+	cfg.polkaEvents = webhook.NewRegistry()
+	calls := 0
+	cfg.polkaEvents.Handle("user.upgraded", func(ctx context.Context, data json.RawMessage) error {
+		calls++
+		if cfg.webhookQueries(ctx) == cfg.dbQueries {
+			t.Error("handler runs outside the event's transaction")
+		}
+		return handlerErr
+	})
+	return cfg, mock, &calls
+}
+
+func signedPolkaRequest(body []byte) *http.Request {
+	timestamp := time.Now().Unix()
+	req := httptest.NewRequest(http.MethodPost, "/api/polka/webhooks", bytes.NewReader(body))
+	req.Header.Set(webhook.TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(webhook.SignatureHeader, "v1="+webhook.Sign(testPolkaSecret, timestamp, body))
+	return req
+}
+
+func TestReceivePolkaWebhook(t *testing.T) {
+	body := []byte(`{"id":"evt_1","event":"user.upgraded","data":{"user_id":"` + uuid.NewString() + `"}}`)
+	now := time.Now().UTC()
+	event := func(status string, updatedAt time.Time) database.WebhookEvent {
+		return database.WebhookEvent{
+			ID:        uuid.New(),
+			CreatedAt: updatedAt,
+			UpdatedAt: updatedAt,
+			EventID:   "evt_1",
+			EventType: "user.upgraded",
+			Payload:   body,
+			Status:    status,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		handlerErr error
+		expect     func(mock sqlmock.Sqlmock)
+		wantStatus int
+		wantCalls  int
+	}{
+		{
+			name: "New event",
+			expect: func(mock sqlmock.Sqlmock) {
+				e := event(webhookStatusPending, now)
+				expectQuery(mock, "CreateWebhookEvent").WillReturnRows(webhookEventRows(e))
+				mock.ExpectBegin()
+				e.Status = webhookStatusProcessed
+				expectQuery(mock, "FinishWebhookEvent").WithArgs(webhookStatusProcessed, nil, e.ID).WillReturnRows(webhookEventRows(e))
+				mock.ExpectCommit()
+			},
+			wantStatus: http.StatusNoContent,
+			wantCalls:  1,
+		},
+		{
+			name:       "Failing handler asks Polka to retry",
+			handlerErr: errors.New("database is down"),
+			expect: func(mock sqlmock.Sqlmock) {
+				e := event(webhookStatusPending, now)
+				expectQuery(mock, "CreateWebhookEvent").WillReturnRows(webhookEventRows(e))
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+				e.Status = webhookStatusFailed
+				expectQuery(mock, "FinishWebhookEvent").WithArgs(webhookStatusFailed, "database is down", e.ID).WillReturnRows(webhookEventRows(e))
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantCalls:  1,
+		},
+		{
+			name: "Processed event is acknowledged again",
+			expect: func(mock sqlmock.Sqlmock) {
+				expectQuery(mock, "CreateWebhookEvent").WillReturnRows(webhookEventRows())
+				expectQuery(mock, "GetWebhookEventByEventID").WillReturnRows(webhookEventRows(event(webhookStatusProcessed, now)))
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "Failed event is processed again",
+			expect: func(mock sqlmock.Sqlmock) {
+				e := event(webhookStatusFailed, now)
+				expectQuery(mock, "CreateWebhookEvent").WillReturnRows(webhookEventRows())
+				expectQuery(mock, "GetWebhookEventByEventID").WillReturnRows(webhookEventRows(e))
+				e.Status = webhookStatusPending
+				expectQuery(mock, "ClaimWebhookEvent").WithArgs(e.ID, sqlmock.AnyArg()).WillReturnRows(webhookEventRows(e))
+				mock.ExpectBegin()
+				e.Status = webhookStatusProcessed
+				expectQuery(mock, "FinishWebhookEvent").WillReturnRows(webhookEventRows(e))
+				mock.ExpectCommit()
+			},
+			wantStatus: http.StatusNoContent,
+			wantCalls:  1,
+		},
+		{
+			name: "Abandoned pending event is processed again",
+			expect: func(mock sqlmock.Sqlmock) {
+				e := event(webhookStatusPending, now.Add(-time.Hour))
+				expectQuery(mock, "CreateWebhookEvent").WillReturnRows(webhookEventRows())
+				expectQuery(mock, "GetWebhookEventByEventID").WillReturnRows(webhookEventRows(e))
+				expectQuery(mock, "ClaimWebhookEvent").WithArgs(e.ID, sqlmock.AnyArg()).WillReturnRows(webhookEventRows(e))
+				mock.ExpectBegin()
+				e.Status = webhookStatusProcessed
+				expectQuery(mock, "FinishWebhookEvent").WillReturnRows(webhookEventRows(e))
+				mock.ExpectCommit()
+			},
+			wantStatus: http.StatusNoContent,
+			wantCalls:  1,
+		},
+		{
+			name: "Pending event within its lease isn't acknowledged",
+			expect: func(mock sqlmock.Sqlmock) {
+				e := event(webhookStatusPending, now)
+				expectQuery(mock, "CreateWebhookEvent").WillReturnRows(webhookEventRows())
+				expectQuery(mock, "GetWebhookEventByEventID").WillReturnRows(webhookEventRows(e))
+				expectQuery(mock, "ClaimWebhookEvent").WillReturnRows(webhookEventRows())
+			},
+			wantStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock, calls := newPolkaTestConfig(t, tt.handlerErr)
+			expectExec(mock, "DeleteExpiredWebhookSignatures").WillReturnResult(sqlmock.NewResult(0, 0))
+			expectQuery(mock, "WebhookSignatureRecorded").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			tt.expect(mock)
+			// Only deliveries that were processed are remembered, so the
+			// others can be retried.
+			if tt.wantStatus == http.StatusNoContent {
+				expectExec(mock, "RecordWebhookSignature").WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			res := httptest.NewRecorder()
+			cfg.receivePolkaWebhook(res, signedPolkaRequest(body))
+
+			if res.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", res.Code, tt.wantStatus, res.Body)
+			}
+			if *calls != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", *calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestReceivePolkaWebhookReplayedDelivery(t *testing.T) {
+	cfg, mock, calls := newPolkaTestConfig(t, nil)
+	expectExec(mock, "DeleteExpiredWebhookSignatures").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectQuery(mock, "WebhookSignatureRecorded").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	res := httptest.NewRecorder()
+	cfg.receivePolkaWebhook(res, signedPolkaRequest([]byte(`{"id":"evt_1","event":"user.upgraded"}`)))
+
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", res.Code, http.StatusUnauthorized)
+	}
+	if *calls != 0 {
+		t.Errorf("handler called %d times for a replayed delivery", *calls)
+	}
+}
+
+func TestReplayWebhookEvent(t *testing.T) {
+	body := []byte(`{"id":"evt_1","event":"user.upgraded","data":{}}`)
+	e := database.WebhookEvent{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC().Add(-time.Hour),
+		UpdatedAt: time.Now().UTC().Add(-time.Hour),
+		EventID:   "evt_1",
+		EventType: "user.upgraded",
+		Payload:   body,
+		Status:    webhookStatusPending,
+	}
+
+	tests := []struct {
+		name       string
+		claimed    bool
+		wantStatus int
+		wantCalls  int
+	}{
+		{name: "Stalled event", claimed: true, wantStatus: http.StatusOK, wantCalls: 1},
+		{name: "Event that can't be claimed", claimed: false, wantStatus: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock, calls := newPolkaTestConfig(t, nil)
+			expectQuery(mock, "GetWebhookEvent").WithArgs(e.ID).WillReturnRows(webhookEventRows(e))
+			if tt.claimed {
+				expectQuery(mock, "ClaimWebhookEvent").WillReturnRows(webhookEventRows(e))
+				mock.ExpectBegin()
+				processed := e
+				processed.Status = webhookStatusProcessed
+				expectQuery(mock, "FinishWebhookEvent").WillReturnRows(webhookEventRows(processed))
+				mock.ExpectCommit()
+			} else {
+				expectQuery(mock, "ClaimWebhookEvent").WillReturnRows(webhookEventRows())
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/webhooks/events/"+e.ID.String()+"/replay", nil)
+			req.SetPathValue("eventID", e.ID.String())
+			res := httptest.NewRecorder()
+			cfg.replayWebhookEvent(res, req)
+
+			if res.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", res.Code, tt.wantStatus, res.Body)
+			}
+			if *calls != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", *calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/google/uuid"
+)
+
+// Token versions bumped by another instance take up to
+// tokenVersionCacheTTL to be noticed here.
+const (
+	tokenVersionCacheTTL  = 30 * time.Second
+	tokenVersionCacheSize = 10000
+)
+
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	Current    bool      `json:"current"`
+	// Set for sessions created by authorizing an OAuth client.
+	ClientID *uuid.UUID `json:"client_id,omitempty"`
+}
+
+func (cfg *apiConfig) listSessions(res http.ResponseWriter, req *http.Request) {
+	principal := requestPrincipal(req)
+
+	dbSessions, err := cfg.dbQueries.GetActiveSessionsByUserID(req.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't get sessions", err)
+		return
+	}
+
+	sessions := []Session{}
+	for _, session := range dbSessions {
+		resp := Session{
+			ID:         session.ID,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IpAddress,
+			Current:    session.ID == principal.SessionID,
+		}
+		if session.ClientID.Valid {
+			resp.ClientID = &session.ClientID.UUID
+		}
+		sessions = append(sessions, resp)
+	}
+
+	respondWithJSON(res, http.StatusOK, sessions)
+}
+
+func (cfg *apiConfig) deleteSession(res http.ResponseWriter, req *http.Request) {
+	sessionID, err := uuid.Parse(req.PathValue("sessionID"))
+	if err != nil {
+		respondWithError(res, http.StatusBadRequest, "Invalid session ID", err)
+		return
+	}
+
+	principal := requestPrincipal(req)
+	userID := principal.UserID
+
+	_, err = cfg.dbQueries.RevokeUserSession(req.Context(), database.RevokeUserSessionParams{
+		ID:     sessionID,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(res, http.StatusNotFound, "Couldn't find session", err)
+		return
+	}
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+
+	_, err = cfg.dbQueries.RevokeRefreshTokenFamily(req.Context(), sessionID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke session", err)
+		return
+	}
+
+	if sessionID == principal.SessionID {
+		_, err = cfg.revokeAccessTokens(req.Context(), userID)
+		if err != nil {
+			respondWithError(res, http.StatusInternalServerError, "Couldn't revoke session", err)
+			return
+		}
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+	cfg.revokeAccessTokensAndRenew(res, req, "Couldn't revoke session")
+}
+
+func (cfg *apiConfig) revokeOtherSessions(res http.ResponseWriter, req *http.Request) {
+	principal := requestPrincipal(req)
+	userID := principal.UserID
+
+	_, err := cfg.dbQueries.RevokeOtherSessions(req.Context(), database.RevokeOtherSessionsParams{
+		UserID: userID,
+		ID:     principal.SessionID,
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	err = cfg.dbQueries.RevokeOtherRefreshTokens(req.Context(), database.RevokeOtherRefreshTokensParams{
+		UserID:   userID,
+		FamilyID: principal.SessionID,
+	})
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, "Couldn't revoke sessions", err)
+		return
+	}
+
+	cfg.revokeAccessTokensAndRenew(res, req, "Couldn't revoke sessions")
+}
+
+// revokeAccessTokens bumps the user's token version, which ends every access
+// token they hold. Access tokens aren't checked against their session, so
+// this is how revoking a session takes effect before they expire.
+func (cfg *apiConfig) revokeAccessTokens(ctx context.Context, userID uuid.UUID) (int32, error) {
+	version, err := cfg.dbQueries.BumpTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	cfg.tokenVersions.Set(userID, version)
+	return version, nil
+}
+
+// revokeAccessTokensAndRenew ends the access tokens of the caller's other
+// sessions and answers with a new one for the caller's own, since the bump
+// ends that one too. Sessions that are still active get theirs by
+// refreshing.
+func (cfg *apiConfig) revokeAccessTokensAndRenew(res http.ResponseWriter, req *http.Request, errMsg string) {
+	type renewResponse struct {
+		Token string `json:"token"`
+	}
+
+	principal := requestPrincipal(req)
+	version, err := cfg.revokeAccessTokens(req.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, errMsg, err)
+		return
+	}
+
+	token, err := cfg.renewAccessToken(res, principal, version)
+	if err != nil {
+		respondWithError(res, http.StatusInternalServerError, errMsg, err)
+		return
+	}
+	if token == "" {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+	respondWithJSON(res, http.StatusOK, renewResponse{Token: token})
+}
+
+// renewAccessToken issues the caller a new access token for its session at
+// the given token version. Browser sessions get it as a cookie and "" is
+// returned; other callers get it back to send in the response. Callers
+// without a session have nothing to renew.
+func (cfg *apiConfig) renewAccessToken(res http.ResponseWriter, principal *Principal, version int32) (string, error) {
+	if principal.SessionID == uuid.Nil {
+		return "", nil
+	}
+
+	options := []auth.ClaimOption{
+		auth.WithSessionID(principal.SessionID),
+		auth.WithRole(principal.Role),
+		auth.WithTokenVersion(version),
+	}
+	if principal.ClientID != uuid.Nil {
+		options = append(options, auth.WithClient(principal.ClientID, principal.Scopes))
+	}
+	token, err := auth.MakeJWT(principal.UserID, cfg.jwtKeys, time.Hour, options...)
+	if err != nil {
+		return "", err
+	}
+
+	if principal.Method == authMethodSessionCookie {
+		setAccessTokenCookie(res, token, time.Now().UTC().Add(time.Hour))
+		return "", nil
+	}
+	return token, nil
+}
+
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Wolfy-22/Chirpy.git/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestDeleteSessionRevokesItsAccessToken(t *testing.T) {
+	cfg, mock := newTestConfig(t)
+	userID := uuid.New()
+	currentID := uuid.New()
+	otherID := uuid.New()
+
+	otherToken, err := auth.MakeJWT(userID, cfg.jwtKeys, time.Hour, auth.WithSessionID(otherID), auth.WithTokenVersion(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectQuery(mock, "RevokeUserSession").WithArgs(otherID, userID).WillReturnRows(sessionRows(otherID, userID, time.Now().UTC()))
+	expectExec(mock, "RevokeRefreshTokenFamily").WithArgs(otherID).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectQuery(mock, "BumpTokenVersion").WithArgs(userID).WillReturnRows(sqlmock.NewRows([]string{"token_version"}).AddRow(2))
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/sessions/"+otherID.String(), nil)
+	req.SetPathValue("sessionID", otherID.String())
+	req = withPrincipal(req, &Principal{UserID: userID, Role: auth.RoleUser, Method: authMethodAccessToken, SessionID: currentID})
+	res := httptest.NewRecorder()
+	cfg.deleteSession(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", res.Code, http.StatusOK, res.Body)
+	}
+
+	// The revoked session's access token is rejected without looking the
+	// session up, and the caller's new one is accepted.
+	if _, err := cfg.resolveAccessToken(req.Context(), otherToken); err == nil {
+		t.Error("access token of the revoked session still accepted")
+	}
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	principal, err := cfg.resolveAccessToken(req.Context(), body.Token)
+	if err != nil {
+		t.Fatalf("renewed access token rejected: %v", err)
+	}
+	if principal.SessionID != currentID {
+		t.Errorf("renewed access token is for session %s, want %s", principal.SessionID, currentID)
+	}
+}
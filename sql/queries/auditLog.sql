@@ -0,0 +1,18 @@
+-- name: CreateAuditLogEntry :exec
+insert into audit_log (id, created_at, action, actor_id, user_id, impersonation_id, request, status)
+values (
+    gen_random_uuid(),
+    now(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+);
+
+-- name: ListAuditLogEntries :many
+select * from audit_log
+where (sqlc.narg(user_id)::uuid is null or user_id = sqlc.narg(user_id)::uuid)
+order by created_at desc
+limit sqlc.arg(max_entries);
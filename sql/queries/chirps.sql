@@ -9,13 +9,21 @@ values (
 )
 returning *;
 
--- name: GetAllChirpsAsc :many
-select * from chirps 
-order by created_at asc;
+-- name: ListChirpsAsc :many
+select * from chirps
+where (sqlc.narg(user_id)::uuid is null or user_id = sqlc.narg(user_id)::uuid)
+and (sqlc.narg(after_created_at)::timestamp is null
+    or (created_at, id) > (sqlc.narg(after_created_at)::timestamp, sqlc.narg(after_id)::uuid))
+order by created_at asc, id asc
+limit sqlc.arg(max_chirps);
 
--- name: GetAllChirpsDesc :many
-select * from chirps 
-order by created_at desc;
+-- name: ListChirpsDesc :many
+select * from chirps
+where (sqlc.narg(user_id)::uuid is null or user_id = sqlc.narg(user_id)::uuid)
+and (sqlc.narg(after_created_at)::timestamp is null
+    or (created_at, id) < (sqlc.narg(after_created_at)::timestamp, sqlc.narg(after_id)::uuid))
+order by created_at desc, id desc
+limit sqlc.arg(max_chirps);
 
 -- name: GetChirpByID :one
 select * from chirps where id = $1;
@@ -31,4 +39,6 @@ order by created_at asc;
 -- name: GetChirpsByUserIDDesc :many
 select * from chirps
 where user_id = $1
-order by created_at desc;
\ No newline at end of file
+order by created_at desc;
+-- name: CountChirpsByUserID :one
+select count(*) from chirps where user_id = $1;
@@ -0,0 +1,44 @@
+-- name: CreateDataExport :one
+insert into data_exports (id, created_at, updated_at, expires_at, format, status, user_id)
+values (
+    gen_random_uuid(),
+    now(),
+    now(),
+    $1,
+    $2,
+    'pending',
+    $3
+)
+returning *;
+
+-- name: GetDataExport :one
+select * from data_exports
+where id = $1
+and user_id = $2
+and expires_at > now();
+
+-- name: CompleteDataExport :exec
+update data_exports set status = 'ready', archive = $1, updated_at = now()
+where id = $2;
+
+-- name: FailDataExport :exec
+update data_exports set status = 'failed', error = $1, updated_at = now()
+where id = $2;
+
+-- name: DeleteExpiredDataExports :exec
+delete from data_exports where expires_at < now();
+
+-- name: GetReusableDataExport :one
+select * from data_exports
+where user_id = sqlc.arg(user_id)
+and format = sqlc.arg(format)
+and created_at > sqlc.arg(created_after)
+and (status = 'ready' or (status = 'pending' and updated_at > sqlc.arg(pending_after)))
+and expires_at > now()
+order by created_at desc
+limit 1;
+
+-- name: FailStaleDataExports :execrows
+update data_exports set status = 'failed', error = 'Export was interrupted', updated_at = now()
+where status = 'pending'
+and updated_at < $1;
@@ -0,0 +1,16 @@
+-- name: CreateEmailVerificationToken :exec
+insert into email_verification_tokens (token_hash, created_at, expires_at, email, user_id)
+values (
+    $1,
+    now(),
+    $2,
+    $3,
+    $4
+);
+
+-- name: ConsumeEmailVerificationToken :one
+update email_verification_tokens set used_at = now()
+where token_hash = $1
+and used_at is null
+and expires_at > now()
+returning *;
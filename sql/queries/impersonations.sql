@@ -0,0 +1,23 @@
+-- name: CreateImpersonation :one
+insert into impersonations (id, created_at, expires_at, reason, admin_id, user_id)
+values (
+    gen_random_uuid(),
+    now(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+returning *;
+
+-- name: GetActiveImpersonation :one
+select * from impersonations
+where id = $1
+and ended_at is null
+and expires_at > now();
+
+-- name: EndImpersonation :one
+update impersonations set ended_at = now()
+where id = $1
+and ended_at is null
+returning *;
@@ -0,0 +1,31 @@
+-- name: GetLoginLocks :many
+select * from login_attempts
+where ((kind = 'account' and subject = sqlc.arg(email)::text)
+or (kind = 'ip' and subject = sqlc.arg(ip)::text))
+and locked_until > now();
+
+-- name: RecordLoginFailure :one
+insert into login_attempts (kind, subject, failures, last_failure_at)
+values (
+    sqlc.arg(kind),
+    sqlc.arg(subject),
+    1,
+    now()
+)
+on conflict (kind, subject) do update set
+failures = case
+    when login_attempts.last_failure_at < sqlc.arg(reset_before)::timestamp then 1
+    else login_attempts.failures + 1
+end,
+last_failure_at = now()
+returning *;
+
+-- name: LockLoginSubject :exec
+update login_attempts set locked_until = $3
+where kind = $1
+and subject = $2;
+
+-- name: ClearLoginFailures :execrows
+delete from login_attempts
+where kind = $1
+and subject = $2;
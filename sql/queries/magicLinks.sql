@@ -0,0 +1,32 @@
+-- name: CreateMagicLinkToken :exec
+insert into magic_link_tokens (token_hash, created_at, expires_at, user_id)
+values (
+    $1,
+    now(),
+    $2,
+    $3
+);
+
+-- name: ConsumeMagicLinkToken :one
+update magic_link_tokens set used_at = now()
+where token_hash = $1
+and used_at is null
+and expires_at > now()
+returning *;
+
+-- name: DeleteUnusedMagicLinkTokens :exec
+delete from magic_link_tokens
+where user_id = $1
+and used_at is null;
+
+-- name: RecordMagicLinkRequest :exec
+insert into magic_link_requests (email, requested_at)
+values ($1, now());
+
+-- name: CountMagicLinkRequestsSince :one
+select count(*) from magic_link_requests
+where email = $1
+and requested_at > $2;
+
+-- name: DeleteOldMagicLinkRequests :exec
+delete from magic_link_requests where requested_at < $1;
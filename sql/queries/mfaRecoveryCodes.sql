@@ -0,0 +1,17 @@
+-- name: CreateRecoveryCode :exec
+insert into mfa_recovery_codes (id, created_at, code_hash, user_id)
+values (
+    gen_random_uuid(),
+    now(),
+    $1,
+    $2
+);
+
+-- name: UseRecoveryCode :execrows
+update mfa_recovery_codes set used_at = now()
+where user_id = $1
+and code_hash = $2
+and used_at is null;
+
+-- name: DeleteRecoveryCodes :exec
+delete from mfa_recovery_codes where user_id = $1;
@@ -0,0 +1,8 @@
+-- name: UseMFAToken :execrows
+insert into used_mfa_tokens (token_id, expires_at)
+values ($1, $2)
+on conflict (token_id) do nothing;
+
+-- name: DeleteExpiredMFATokens :exec
+delete from used_mfa_tokens
+where expires_at < now();
@@ -0,0 +1,50 @@
+-- name: CreateOAuthClient :one
+insert into oauth_clients (id, created_at, updated_at, name, secret_hash, redirect_uris, scopes, created_by)
+values (
+    gen_random_uuid(),
+    now(),
+    now(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+returning *;
+
+-- name: GetOAuthClient :one
+select * from oauth_clients
+where id = $1
+and revoked_at is null;
+
+-- name: ListOAuthClients :many
+select * from oauth_clients
+where revoked_at is null
+order by created_at desc;
+
+-- name: RevokeOAuthClient :one
+update oauth_clients set revoked_at = now(), updated_at = now()
+where id = $1
+and revoked_at is null
+returning *;
+
+-- name: CreateOAuthAuthorizationCode :exec
+insert into oauth_authorization_codes (code_hash, created_at, expires_at, redirect_uri, scopes, code_challenge, client_id, user_id)
+values (
+    $1,
+    now(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7
+);
+
+-- name: ConsumeOAuthAuthorizationCode :one
+update oauth_authorization_codes set used_at = now()
+where code_hash = $1
+and client_id = $2
+and used_at is null
+and expires_at > now()
+returning *;
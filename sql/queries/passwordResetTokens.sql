@@ -0,0 +1,24 @@
+-- name: CreatePasswordResetToken :exec
+insert into password_reset_tokens (token_hash, created_at, expires_at, user_id)
+values (
+    $1,
+    now(),
+    $2,
+    $3
+);
+
+-- name: ConsumePasswordResetToken :one
+update password_reset_tokens set used_at = now()
+where token_hash = $1
+and used_at is null
+and expires_at > now()
+returning *;
+
+-- name: DeletePasswordResetTokensByUserID :exec
+delete from password_reset_tokens where user_id = $1;
+
+-- name: GetActivePasswordResetToken :one
+select * from password_reset_tokens
+where token_hash = $1
+and used_at is null
+and expires_at > now();
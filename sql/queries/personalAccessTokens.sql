@@ -0,0 +1,41 @@
+-- name: CreatePersonalAccessToken :one
+insert into personal_access_tokens (id, created_at, updated_at, name, token_hash, scopes, expires_at, user_id)
+values (
+    gen_random_uuid(),
+    now(),
+    now(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+returning *;
+
+-- name: GetPersonalAccessTokenByHash :one
+select * from personal_access_tokens
+where token_hash = $1
+and revoked_at is null
+and (expires_at is null or expires_at > now())
+and not exists (
+    select 1 from users
+    where users.id = personal_access_tokens.user_id
+    and (users.suspended_at is not null or users.deletion_scheduled_at is not null)
+);
+
+-- name: GetPersonalAccessTokensByUserID :many
+select * from personal_access_tokens
+where user_id = $1
+and revoked_at is null
+order by created_at desc;
+
+-- name: RevokePersonalAccessToken :one
+update personal_access_tokens set revoked_at = now(), updated_at = now()
+where id = $1
+and user_id = $2
+and revoked_at is null
+returning *;
+
+-- name: TouchPersonalAccessToken :exec
+update personal_access_tokens set last_used_at = now()
+where id = $1;
@@ -1,23 +1,60 @@
 -- name: CreateToken :one
-insert into refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+insert into refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, family_id)
 values (
     $1, 
     now(),
     now(),
     $2, 
-    $3
+    $3,
+    $4
 )
 returning *;
 
 -- name: GetUserFromRefreshToken :one
 SELECT users.* FROM users
 JOIN refresh_tokens ON users.id = refresh_tokens.user_id
-WHERE refresh_tokens.token = $1
+WHERE refresh_tokens.token_hash = $1
 AND revoked_at IS NULL
 AND expires_at > NOW();
 
 -- name: RevokeRefreshToken :one
 UPDATE refresh_tokens SET revoked_at = NOW(),
 updated_at = NOW()
-WHERE token = $1
-RETURNING *;
\ No newline at end of file
+WHERE token_hash = $1
+RETURNING *;
+
+-- name: GetRefreshToken :one
+select * from refresh_tokens where token_hash = $1;
+
+-- name: RotateRefreshToken :one
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW(),
+replaced_by = $2
+WHERE token_hash = $1
+AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE family_id = $1
+AND revoked_at IS NULL;
+
+-- name: RevokeOtherRefreshTokens :exec
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE user_id = $1
+AND family_id <> $2
+AND revoked_at IS NULL;
+
+-- name: RevokeAllRefreshTokens :exec
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE user_id = $1
+AND revoked_at IS NULL;
+
+-- name: RevokeClientRefreshTokens :exec
+UPDATE refresh_tokens SET revoked_at = NOW(),
+updated_at = NOW()
+WHERE family_id IN (SELECT id FROM sessions WHERE client_id = $1)
+AND revoked_at IS NULL;
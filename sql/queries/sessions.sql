@@ -0,0 +1,82 @@
+-- name: CreateSession :one
+insert into sessions (id, created_at, updated_at, last_used_at, expires_at, user_agent, ip_address, user_id)
+values (
+    gen_random_uuid(),
+    now(),
+    now(),
+    now(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+returning *;
+
+-- name: GetSessionByID :one
+select * from sessions where id = $1;
+
+-- name: GetActiveSessionsByUserID :many
+select * from sessions
+where user_id = $1
+and revoked_at is null
+and expires_at > now()
+order by last_used_at desc;
+
+-- name: TouchSession :exec
+update sessions set last_used_at = now(), updated_at = now()
+where id = $1;
+
+-- name: RevokeSession :exec
+update sessions set revoked_at = now(), updated_at = now()
+where id = $1
+and revoked_at is null;
+
+-- name: RevokeUserSession :one
+update sessions set revoked_at = now(), updated_at = now()
+where id = $1
+and user_id = $2
+and revoked_at is null
+returning *;
+
+-- name: RevokeOtherSessions :execrows
+update sessions set revoked_at = now(), updated_at = now()
+where user_id = $1
+and id <> $2
+and revoked_at is null;
+
+-- name: RevokeAllSessions :exec
+update sessions set revoked_at = now(), updated_at = now()
+where user_id = $1
+and revoked_at is null;
+
+-- name: GetSessionsByUserID :many
+select * from sessions
+where user_id = $1
+order by created_at desc;
+
+-- name: CreateClientSession :one
+insert into sessions (id, created_at, updated_at, last_used_at, expires_at, user_agent, ip_address, user_id, client_id, scopes)
+values (
+    gen_random_uuid(),
+    now(),
+    now(),
+    now(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+returning *;
+
+-- name: GetActiveSession :one
+select * from sessions
+where id = $1
+and revoked_at is null
+and expires_at > now();
+
+-- name: RevokeClientSessions :exec
+update sessions set revoked_at = now(), updated_at = now()
+where client_id = $1
+and revoked_at is null;
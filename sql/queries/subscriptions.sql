@@ -0,0 +1,48 @@
+-- name: UpsertSubscription :one
+insert into subscriptions (id, created_at, updated_at, plan, status, current_period_start, current_period_end, user_id, last_event_id)
+values (
+    gen_random_uuid(),
+    now(),
+    now(),
+    $1,
+    'active',
+    $2,
+    $3,
+    $4,
+    $5
+)
+on conflict (user_id) do update set plan = excluded.plan,
+status = 'active',
+current_period_start = excluded.current_period_start,
+current_period_end = excluded.current_period_end,
+canceled_at = null,
+last_event_id = excluded.last_event_id,
+updated_at = now()
+where excluded.last_event_id is null
+or subscriptions.last_event_id is distinct from excluded.last_event_id
+returning *;
+
+-- name: GetSubscriptionByUserID :one
+select * from subscriptions where user_id = $1;
+
+-- name: EndSubscription :one
+update subscriptions set status = $1,
+canceled_at = now(),
+current_period_end = least(current_period_end, now()),
+updated_at = now()
+where user_id = $2
+and status = 'active'
+returning *;
+
+-- name: ExpireSubscriptions :execrows
+update subscriptions set status = 'expired', updated_at = now()
+where status = 'active'
+and current_period_end <= now();
+
+-- name: HasActiveSubscription :one
+select exists (
+    select 1 from subscriptions
+    where user_id = $1
+    and status = 'active'
+    and current_period_end > now()
+);
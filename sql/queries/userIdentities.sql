@@ -0,0 +1,39 @@
+-- name: GetUserByIdentity :one
+select users.* from users
+join user_identities on users.id = user_identities.user_id
+where user_identities.provider = $1
+and user_identities.subject = $2;
+
+-- name: CreateUserIdentity :one
+insert into user_identities (id, created_at, updated_at, provider, subject, email, user_id)
+values (
+    gen_random_uuid(),
+    now(),
+    now(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+returning *;
+
+-- name: CreateOIDCLoginState :exec
+insert into oidc_login_states (state_hash, created_at, expires_at, provider, nonce, code_verifier)
+values (
+    $1,
+    now(),
+    $2,
+    $3,
+    $4,
+    $5
+);
+
+-- name: ConsumeOIDCLoginState :one
+delete from oidc_login_states
+where state_hash = $1
+and provider = $2
+and expires_at > now()
+returning *;
+
+-- name: DeleteExpiredOIDCLoginStates :exec
+delete from oidc_login_states where expires_at <= now();
@@ -15,11 +15,131 @@ delete from users;
 -- name: GetUserByEmail :one
 select * from users where email = $1;
 
--- name: UpdateUserEmailAndPasswordByUserID :one
-update users set email = $1, hashed_password = $2, updated_at = now()
-where id = $3
+-- name: UpdateUserPasswordAndPendingEmailByUserID :one
+update users set hashed_password = coalesce(sqlc.narg(hashed_password)::text, hashed_password),
+pending_email = coalesce(sqlc.narg(pending_email), pending_email),
+token_version = token_version + (case when sqlc.narg(hashed_password)::text is null then 0 else 1 end),
+updated_at = now()
+where id = sqlc.arg(id)
 returning *;
 
--- name: UpgradesToChirpyRedViaID :exec
-update users set is_chirpy_red = true, updated_at = now()
-where id = $1;
\ No newline at end of file
+-- name: GetUserByID :one
+select * from users where id = $1;
+
+-- name: SetPendingTOTPSecret :exec
+update users set totp_secret = $1, totp_enabled_at = null, updated_at = now()
+where id = $2;
+
+-- name: EnableTOTP :exec
+update users set totp_enabled_at = now(), totp_last_step = $1, updated_at = now()
+where id = $2;
+
+-- name: DisableTOTP :exec
+update users set totp_secret = null, totp_enabled_at = null, totp_last_step = 0, updated_at = now()
+where id = $1;
+
+-- name: UseTOTPStep :execrows
+update users set totp_last_step = $1
+where id = $2
+and totp_last_step < $1;
+
+-- name: UpdateUserPassword :exec
+update users set hashed_password = $1, token_version = token_version + 1, updated_at = now()
+where id = $2;
+
+-- name: MarkEmailVerified :one
+update users set email_verified_at = now(), updated_at = now()
+where id = $1
+and email = $2
+returning *;
+
+-- name: ApplyPendingEmail :one
+update users set email = pending_email,
+pending_email = null,
+email_verified_at = now(),
+updated_at = now()
+where id = sqlc.arg(id)
+and pending_email = sqlc.arg(email)::text
+returning *;
+
+-- name: CreateUserWithoutPassword :one
+insert into users (id, created_at, updated_at, email, email_verified_at)
+values (
+    gen_random_uuid(),
+    now(),
+    now(),
+    $1,
+    $2
+)
+returning *;
+
+-- name: SetUserRole :one
+update users set role = $1, token_version = token_version + 1, updated_at = now()
+where id = $2
+returning *;
+
+-- name: CountUsersByRole :one
+select count(*) from users where role = $1;
+
+-- name: RehashUserPassword :exec
+update users set hashed_password = sqlc.arg(new_hash)
+where id = sqlc.arg(id)
+and hashed_password = sqlc.arg(old_hash);
+
+-- name: CountUsersByPasswordParams :many
+select split_part(hashed_password, '$', 4)::text as params, count(*) as users
+from users
+where hashed_password like '$argon2id$%'
+group by 1
+order by 2 desc;
+
+-- name: GetUserTokenVersion :one
+select token_version from users where id = $1;
+
+-- name: BumpTokenVersion :one
+update users set token_version = token_version + 1, updated_at = now()
+where id = $1
+returning token_version;
+
+-- name: BumpClientUsersTokenVersions :many
+update users set token_version = token_version + 1, updated_at = now()
+where id in (
+    select user_id from sessions
+    where client_id = $1
+    and revoked_at is null
+)
+returning id, token_version;
+
+-- name: SuspendUser :one
+update users set suspended_at = now(), token_version = token_version + 1, updated_at = now()
+where id = $1
+returning *;
+
+-- name: UnsuspendUser :one
+update users set suspended_at = null, updated_at = now()
+where id = $1
+returning *;
+
+-- name: ScheduleUserDeletion :one
+update users set deletion_scheduled_at = $1, token_version = token_version + 1, updated_at = now()
+where id = $2
+returning *;
+
+-- name: CancelUserDeletion :exec
+update users set deletion_scheduled_at = null, updated_at = now()
+where id = $1;
+
+-- name: DeleteScheduledUsers :execrows
+delete from users
+where deletion_scheduled_at is not null
+and deletion_scheduled_at <= now();
+
+-- name: ListPlaintextTOTPSecrets :many
+select id, totp_secret from users
+where totp_secret is not null
+and totp_secret not like 'v1:%';
+
+-- name: EncryptTOTPSecret :exec
+update users set totp_secret = $1
+where id = $2
+and totp_secret not like 'v1:%';
@@ -0,0 +1,41 @@
+-- name: CreateWebhookEvent :one
+insert into webhook_events (id, created_at, updated_at, event_id, event_type, payload, status)
+values (
+    gen_random_uuid(),
+    now(),
+    now(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+on conflict (event_id) do nothing
+returning *;
+
+-- name: GetWebhookEvent :one
+select * from webhook_events where id = $1;
+
+-- name: GetWebhookEventByEventID :one
+select * from webhook_events where event_id = $1;
+
+-- name: ListWebhookEvents :many
+select * from webhook_events
+where (sqlc.narg(status)::text is null or status = sqlc.narg(status)::text)
+order by created_at desc
+limit sqlc.arg(max_events);
+
+-- name: FinishWebhookEvent :one
+update webhook_events set status = $1,
+error = $2,
+attempts = attempts + 1,
+processed_at = case when $1 = 'processed' then now() else processed_at end,
+updated_at = now()
+where id = $3
+returning *;
+
+-- name: ClaimWebhookEvent :one
+update webhook_events set status = 'pending',
+updated_at = now()
+where id = sqlc.arg(id)
+and (status = 'failed' or (status = 'pending' and updated_at < sqlc.arg(stale_before)))
+returning *;
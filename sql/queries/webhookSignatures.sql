@@ -0,0 +1,14 @@
+-- name: RecordWebhookSignature :execrows
+insert into webhook_signatures (replay_key, expires_at)
+values ($1, $2)
+on conflict (replay_key) do nothing;
+
+-- name: DeleteExpiredWebhookSignatures :exec
+delete from webhook_signatures where expires_at < now();
+
+-- name: WebhookSignatureRecorded :one
+select exists (
+    select 1 from webhook_signatures
+    where replay_key = $1
+    and expires_at >= now()
+);
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Existing rows hold raw tokens and the hashing key isn't available to SQL,
+-- so they are dropped and every user has to log in again.
+delete from refresh_tokens;
+alter table refresh_tokens rename column token to token_hash;
+
+-- +goose Down
+delete from refresh_tokens;
+alter table refresh_tokens rename column token_hash to token;
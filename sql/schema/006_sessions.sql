@@ -0,0 +1,35 @@
+-- +goose Up
+create table sessions (
+    id UUID primary key,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    last_used_at timestamp not null,
+    expires_at timestamp not null,
+    revoked_at timestamp,
+    user_agent text not null default '',
+    ip_address text not null default '',
+    user_id UUID not null references users(id)
+    on delete cascade
+);
+
+insert into sessions (id, created_at, updated_at, last_used_at, expires_at, user_id)
+select family_id, min(created_at), max(updated_at), max(updated_at), max(expires_at), user_id
+from refresh_tokens
+group by family_id, user_id;
+
+update sessions set revoked_at = now()
+where not exists (
+    select 1 from refresh_tokens
+    where refresh_tokens.family_id = sessions.id
+    and refresh_tokens.revoked_at is null
+);
+
+alter table refresh_tokens add constraint refresh_tokens_family_id_fkey
+foreign key (family_id) references sessions(id)
+on delete cascade;
+
+create index sessions_user_id_idx on sessions (user_id);
+
+-- +goose Down
+alter table refresh_tokens drop constraint refresh_tokens_family_id_fkey;
+drop table sessions;
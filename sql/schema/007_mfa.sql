@@ -0,0 +1,21 @@
+-- +goose Up
+alter table users add column totp_secret text;
+alter table users add column totp_enabled_at timestamp;
+alter table users add column totp_last_step bigint not null default 0;
+
+create table mfa_recovery_codes (
+    id UUID primary key,
+    created_at timestamp not null,
+    used_at timestamp,
+    code_hash text not null,
+    user_id UUID not null references users(id)
+    on delete cascade
+);
+
+create index mfa_recovery_codes_user_id_idx on mfa_recovery_codes (user_id);
+
+-- +goose Down
+drop table mfa_recovery_codes;
+alter table users drop column totp_last_step;
+alter table users drop column totp_enabled_at;
+alter table users drop column totp_secret;
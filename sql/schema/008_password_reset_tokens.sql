@@ -0,0 +1,12 @@
+-- +goose Up
+create table password_reset_tokens (
+    token_hash text primary key,
+    created_at timestamp not null,
+    expires_at timestamp not null,
+    used_at timestamp,
+    user_id UUID not null references users(id)
+    on delete cascade
+);
+
+-- +goose Down
+drop table password_reset_tokens;
@@ -0,0 +1,22 @@
+-- +goose Up
+alter table users add column email_verified_at timestamp;
+alter table users add column pending_email text;
+
+-- Accounts from before verification existed are grandfathered in, so
+-- REQUIRE_VERIFIED_EMAIL doesn't lock them out of posting.
+update users set email_verified_at = created_at;
+
+create table email_verification_tokens (
+    token_hash text primary key,
+    created_at timestamp not null,
+    expires_at timestamp not null,
+    used_at timestamp,
+    email text not null,
+    user_id UUID not null references users(id)
+    on delete cascade
+);
+
+-- +goose Down
+drop table email_verification_tokens;
+alter table users drop column pending_email;
+alter table users drop column email_verified_at;
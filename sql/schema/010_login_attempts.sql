@@ -0,0 +1,12 @@
+-- +goose Up
+create table login_attempts (
+    kind text not null,
+    subject text not null,
+    failures integer not null,
+    last_failure_at timestamp not null,
+    locked_until timestamp,
+    primary key (kind, subject)
+);
+
+-- +goose Down
+drop table login_attempts;
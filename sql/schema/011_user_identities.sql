@@ -0,0 +1,25 @@
+-- +goose Up
+create table user_identities (
+    id UUID primary key,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    provider text not null,
+    subject text not null,
+    email text not null default '',
+    user_id UUID not null references users(id)
+    on delete cascade,
+    unique (provider, subject)
+);
+
+create table oidc_login_states (
+    state_hash text primary key,
+    created_at timestamp not null,
+    expires_at timestamp not null,
+    provider text not null,
+    nonce text not null,
+    code_verifier text not null
+);
+
+-- +goose Down
+drop table oidc_login_states;
+drop table user_identities;
@@ -0,0 +1,19 @@
+-- +goose Up
+create table personal_access_tokens (
+    id UUID primary key,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    name text not null,
+    token_hash text not null unique,
+    scopes text not null,
+    expires_at timestamp,
+    last_used_at timestamp,
+    revoked_at timestamp,
+    user_id UUID not null references users(id)
+    on delete cascade
+);
+
+create index personal_access_tokens_user_id_idx on personal_access_tokens (user_id);
+
+-- +goose Down
+drop table personal_access_tokens;
@@ -0,0 +1,7 @@
+-- +goose Up
+alter table users add column token_version integer not null default 0;
+alter table users add column suspended_at timestamp;
+
+-- +goose Down
+alter table users drop column suspended_at;
+alter table users drop column token_version;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Deliveries are remembered by ReplayKey, a digest of the timestamp and
+-- body, rather than by signature: a delivery signed with two secrets during
+-- rotation has two valid signatures.
+create table webhook_signatures (
+    replay_key text primary key,
+    expires_at timestamp not null
+);
+
+-- +goose Down
+drop table webhook_signatures;
@@ -0,0 +1,18 @@
+-- +goose Up
+create table webhook_events (
+    id UUID primary key,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    event_id text not null unique,
+    event_type text not null,
+    payload jsonb not null,
+    status text not null,
+    error text,
+    attempts integer not null default 0,
+    processed_at timestamp
+);
+
+create index webhook_events_status_idx on webhook_events (status, created_at);
+
+-- +goose Down
+drop table webhook_events;
@@ -0,0 +1,36 @@
+-- +goose Up
+create table subscriptions (
+    id UUID primary key,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    plan text not null,
+    status text not null,
+    current_period_start timestamp not null,
+    current_period_end timestamp not null,
+    canceled_at timestamp,
+    user_id UUID not null unique references users(id)
+    on delete cascade
+);
+
+create index subscriptions_active_period_end_idx on subscriptions (current_period_end)
+where status = 'active';
+
+-- Upgrades made so far carry no billing period, so they start a fresh one.
+insert into subscriptions (id, created_at, updated_at, plan, status, current_period_start, current_period_end, user_id)
+select gen_random_uuid(), now(), now(), 'chirpy_red', 'active', now(), now() + interval '30 days', id
+from users
+where is_chirpy_red;
+
+alter table users drop column is_chirpy_red;
+
+-- +goose Down
+alter table users add column is_chirpy_red boolean not null default false;
+
+update users set is_chirpy_red = true
+where id in (
+    select user_id from subscriptions
+    where status = 'active'
+    and current_period_end > now()
+);
+
+drop table subscriptions;
@@ -0,0 +1,22 @@
+-- +goose Up
+create table magic_link_tokens (
+    token_hash text primary key,
+    created_at timestamp not null,
+    expires_at timestamp not null,
+    used_at timestamp,
+    user_id UUID not null references users(id)
+    on delete cascade
+);
+
+-- Requests are counted per email whether or not an account exists, so the
+-- rate limit doesn't reveal which addresses are registered.
+create table magic_link_requests (
+    email text not null,
+    requested_at timestamp not null
+);
+
+create index magic_link_requests_email_idx on magic_link_requests (email, requested_at);
+
+-- +goose Down
+drop table magic_link_requests;
+drop table magic_link_tokens;
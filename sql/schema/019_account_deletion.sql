@@ -0,0 +1,22 @@
+-- +goose Up
+alter table users add column deletion_scheduled_at timestamp;
+
+create index users_deletion_scheduled_at_idx on users (deletion_scheduled_at)
+where deletion_scheduled_at is not null;
+
+create table data_exports (
+    id UUID primary key,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    expires_at timestamp not null,
+    format text not null,
+    status text not null,
+    archive bytea,
+    error text,
+    user_id UUID not null references users(id)
+    on delete cascade
+);
+
+-- +goose Down
+drop table data_exports;
+alter table users drop column deletion_scheduled_at;
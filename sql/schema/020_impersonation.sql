@@ -0,0 +1,30 @@
+-- +goose Up
+create table impersonations (
+    id UUID primary key,
+    created_at timestamp not null,
+    expires_at timestamp not null,
+    ended_at timestamp,
+    reason text not null,
+    admin_id UUID not null references users(id)
+    on delete cascade,
+    user_id UUID not null references users(id)
+    on delete cascade
+);
+
+-- The audit log outlives the users it mentions, so it has no foreign keys.
+create table audit_log (
+    id UUID primary key,
+    created_at timestamp not null,
+    action text not null,
+    actor_id UUID not null,
+    user_id UUID not null,
+    impersonation_id UUID,
+    request text,
+    status integer
+);
+
+create index audit_log_user_id_idx on audit_log (user_id, created_at);
+
+-- +goose Down
+drop table audit_log;
+drop table impersonations;
@@ -0,0 +1,39 @@
+-- +goose Up
+create table oauth_clients (
+    id UUID primary key,
+    created_at timestamp not null,
+    updated_at timestamp not null,
+    name text not null,
+    -- Public clients, which can't keep a secret, have none and rely on PKCE.
+    secret_hash text,
+    redirect_uris text not null,
+    scopes text not null,
+    revoked_at timestamp,
+    created_by UUID references users(id)
+    on delete set null
+);
+
+create table oauth_authorization_codes (
+    code_hash text primary key,
+    created_at timestamp not null,
+    expires_at timestamp not null,
+    used_at timestamp,
+    redirect_uri text not null,
+    scopes text not null,
+    code_challenge text not null,
+    client_id UUID not null references oauth_clients(id)
+    on delete cascade,
+    user_id UUID not null references users(id)
+    on delete cascade
+);
+
+-- Sessions started by an OAuth client are limited to the granted scopes.
+alter table sessions add column client_id UUID references oauth_clients(id)
+on delete cascade;
+alter table sessions add column scopes text;
+
+-- +goose Down
+alter table sessions drop column scopes;
+alter table sessions drop column client_id;
+drop table oauth_authorization_codes;
+drop table oauth_clients;
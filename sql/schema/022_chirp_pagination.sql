@@ -0,0 +1,9 @@
+-- +goose Up
+-- Chirps are paged by (created_at, id), with id breaking ties between chirps
+-- created in the same microsecond. Both indexes serve either sort order.
+create index chirps_created_at_id_idx on chirps (created_at, id);
+create index chirps_user_id_created_at_id_idx on chirps (user_id, created_at, id);
+
+-- +goose Down
+drop index chirps_user_id_created_at_id_idx;
+drop index chirps_created_at_id_idx;
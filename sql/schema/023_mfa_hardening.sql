@@ -0,0 +1,12 @@
+-- +goose Up
+-- MFA tokens are exchanged at most once. Their IDs are kept until the token
+-- would have expired anyway.
+create table used_mfa_tokens (
+    token_id UUID primary key,
+    expires_at timestamp not null
+);
+
+create index used_mfa_tokens_expires_at_idx on used_mfa_tokens (expires_at);
+
+-- +goose Down
+drop table used_mfa_tokens;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- The webhook event that last started or renewed the subscription, so a
+-- delivery of the same event can't extend it twice.
+alter table subscriptions add column last_event_id text;
+
+-- +goose Down
+alter table subscriptions drop column last_event_id;
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	subscriptionPlanChirpyRed  = "chirpy_red"
+	subscriptionPeriod         = 30 * 24 * time.Hour
+	subscriptionExpiryInterval = 15 * time.Minute
+
+	subscriptionStatusActive   = "active"
+	subscriptionStatusCanceled = "canceled"
+	subscriptionStatusRefunded = "refunded"
+	subscriptionStatusExpired  = "expired"
+)
+
+// subscriptionEvent is the data of Polka's subscription events. Plan and
+// current_period_end are optional; without them a Chirpy Red plan and a
+// 30 day period are assumed.
+type subscriptionEvent struct {
+	UserID           uuid.UUID  `json:"user_id"`
+	Plan             string     `json:"plan"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end"`
+}
+
+func decodeSubscriptionEvent(data json.RawMessage) (subscriptionEvent, error) {
+	event := subscriptionEvent{}
+	err := json.Unmarshal(data, &event)
+	if err != nil {
+		return event, fmt.Errorf("error decoding data: %w", err)
+	}
+	if event.UserID == uuid.Nil {
+		return event, errors.New("data has no user_id")
+	}
+	if event.Plan == "" {
+		event.Plan = subscriptionPlanChirpyRed
+	}
+	return event, nil
+}
+
+func (e subscriptionEvent) periodEnd(start time.Time) time.Time {
+	if e.CurrentPeriodEnd != nil {
+		return e.CurrentPeriodEnd.UTC()
+	}
+	return start.Add(subscriptionPeriod)
+}
+
+func (cfg *apiConfig) startSubscription(ctx context.Context, data json.RawMessage) error {
+	event, err := decodeSubscriptionEvent(data)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now().UTC()
+	return cfg.upsertSubscription(ctx, database.UpsertSubscriptionParams{
+		Plan:               event.Plan,
+		CurrentPeriodStart: start,
+		CurrentPeriodEnd:   event.periodEnd(start),
+		UserID:             event.UserID,
+		LastEventID:        webhookEventID(ctx),
+	})
+}
+
+// renewSubscription starts the next period where the current one ends, or
+// now if the subscription has already lapsed. A renewal stacks onto the
+// current period, so applying the same event again would add another one;
+// upsertSubscription skips events it has already applied.
+func (cfg *apiConfig) renewSubscription(ctx context.Context, data json.RawMessage) error {
+	event, err := decodeSubscriptionEvent(data)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now().UTC()
+	subscription, err := cfg.webhookQueries(ctx).GetSubscriptionByUserID(ctx, event.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && subscription.Status == subscriptionStatusActive && subscription.CurrentPeriodEnd.After(start) {
+		start = subscription.CurrentPeriodEnd
+	}
+
+	return cfg.upsertSubscription(ctx, database.UpsertSubscriptionParams{
+		Plan:               event.Plan,
+		CurrentPeriodStart: start,
+		CurrentPeriodEnd:   event.periodEnd(start),
+		UserID:             event.UserID,
+		LastEventID:        webhookEventID(ctx),
+	})
+}
+
+// upsertSubscription records the event that started or renewed the
+// subscription with it. The upsert changes nothing for an event that was
+// the last one applied, which isn't an error.
+func (cfg *apiConfig) upsertSubscription(ctx context.Context, params database.UpsertSubscriptionParams) error {
+	_, err := cfg.webhookQueries(ctx).UpsertSubscription(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+func (cfg *apiConfig) cancelSubscription(ctx context.Context, data json.RawMessage) error {
+	return cfg.endSubscription(ctx, data, subscriptionStatusCanceled)
+}
+
+func (cfg *apiConfig) refundSubscription(ctx context.Context, data json.RawMessage) error {
+	return cfg.endSubscription(ctx, data, subscriptionStatusRefunded)
+}
+
+// endSubscription takes Chirpy Red away straight away. A user without an
+// active subscription has nothing left to end.
+func (cfg *apiConfig) endSubscription(ctx context.Context, data json.RawMessage, status string) error {
+	event, err := decodeSubscriptionEvent(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = cfg.webhookQueries(ctx).EndSubscription(ctx, database.EndSubscriptionParams{
+		Status: status,
+		UserID: event.UserID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// expireSubscriptions periodically marks subscriptions whose period ran out
+// without a renewal as expired. Chirpy Red already stops at the end of the
+// period; this keeps the stored status from claiming otherwise.
+func (cfg *apiConfig) expireSubscriptions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := cfg.dbQueries.ExpireSubscriptions(ctx)
+		if err != nil {
+			log.Printf("Error expiring subscriptions: %s", err)
+		} else if expired > 0 {
+			log.Printf("Expired %d subscriptions", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// isChirpyRed is derived from the user's subscription rather than stored on
+// the user, so it can't disagree with it.
+func (cfg *apiConfig) isChirpyRed(ctx context.Context, userID uuid.UUID) (bool, error) {
+	return cfg.dbQueries.HasActiveSubscription(ctx, userID)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Wolfy-22/Chirpy.git/internal/database"
+	"github.com/google/uuid"
+)
+
+// around matches a time argument within a second of want.
+type around time.Time
+
+func (a around) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+	d := t.Sub(time.Time(a))
+	return d > -time.Second && d < time.Second
+}
+
+func subscriptionRows(subscriptions ...database.Subscription) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at", "plan", "status", "current_period_start", "current_period_end", "canceled_at", "user_id", "last_event_id"})
+	for _, s := range subscriptions {
+		rows.AddRow(s.ID.String(), s.CreatedAt, s.UpdatedAt, s.Plan, s.Status, s.CurrentPeriodStart, s.CurrentPeriodEnd, nil, s.UserID.String(), s.LastEventID)
+	}
+	return rows
+}
+
+func subscriptionData(t *testing.T, userID uuid.UUID, periodEnd *time.Time) json.RawMessage {
+	t.Helper()
+	data, err := json.Marshal(subscriptionEvent{UserID: userID, CurrentPeriodEnd: periodEnd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeSubscriptionEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantPlan string
+		wantErr  bool
+	}{
+		{name: "Default plan", data: `{"user_id":"` + uuid.NewString() + `"}`, wantPlan: subscriptionPlanChirpyRed},
+		{name: "Explicit plan", data: `{"user_id":"` + uuid.NewString() + `","plan":"chirpy_blue"}`, wantPlan: "chirpy_blue"},
+		{name: "Missing user_id", data: `{}`, wantErr: true},
+		{name: "Malformed data", data: `[]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := decodeSubscriptionEvent(json.RawMessage(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeSubscriptionEvent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && event.Plan != tt.wantPlan {
+				t.Errorf("decodeSubscriptionEvent() plan = %q, want %q", event.Plan, tt.wantPlan)
+			}
+		})
+	}
+}
+
+func TestStartSubscription(t *testing.T) {
+	now := time.Now().UTC()
+	periodEnd := now.Add(90 * 24 * time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name      string
+		periodEnd *time.Time
+		wantEnd   time.Time
+	}{
+		{name: "Default period", wantEnd: now.Add(subscriptionPeriod)},
+		{name: "current_period_end overrides the default", periodEnd: &periodEnd, wantEnd: periodEnd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			userID := uuid.New()
+			expectQuery(mock, "UpsertSubscription").
+				WithArgs(subscriptionPlanChirpyRed, around(now), around(tt.wantEnd), userID, nil).
+				WillReturnRows(subscriptionRows(database.Subscription{ID: uuid.New(), UserID: userID}))
+
+			err := cfg.startSubscription(context.Background(), subscriptionData(t, userID, tt.periodEnd))
+			if err != nil {
+				t.Errorf("startSubscription() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRenewSubscription(t *testing.T) {
+	now := time.Now().UTC()
+	currentEnd := now.Add(10 * 24 * time.Hour)
+	overrideEnd := now.Add(60 * 24 * time.Hour).Truncate(time.Second)
+
+	tests := []struct {
+		name      string
+		existing  *database.Subscription
+		periodEnd *time.Time
+		// eventID is the webhook event being applied, and applied that it
+		// was the last one applied to the subscription already.
+		eventID   string
+		applied   bool
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "Active subscription stacks onto the current period",
+			existing:  &database.Subscription{Status: subscriptionStatusActive, CurrentPeriodEnd: currentEnd},
+			wantStart: currentEnd,
+			wantEnd:   currentEnd.Add(subscriptionPeriod),
+		},
+		{
+			name:      "Lapsed subscription starts now",
+			existing:  &database.Subscription{Status: subscriptionStatusActive, CurrentPeriodEnd: now.Add(-time.Hour)},
+			wantStart: now,
+			wantEnd:   now.Add(subscriptionPeriod),
+		},
+		{
+			name:      "Canceled subscription starts now",
+			existing:  &database.Subscription{Status: subscriptionStatusCanceled, CurrentPeriodEnd: currentEnd},
+			wantStart: now,
+			wantEnd:   now.Add(subscriptionPeriod),
+		},
+		{
+			name:      "Missing subscription starts now",
+			wantStart: now,
+			wantEnd:   now.Add(subscriptionPeriod),
+		},
+		{
+			name:      "current_period_end overrides the default period",
+			existing:  &database.Subscription{Status: subscriptionStatusActive, CurrentPeriodEnd: currentEnd},
+			periodEnd: &overrideEnd,
+			wantStart: currentEnd,
+			wantEnd:   overrideEnd,
+		},
+		{
+			name:      "Event records its ID",
+			existing:  &database.Subscription{Status: subscriptionStatusActive, CurrentPeriodEnd: currentEnd},
+			eventID:   "evt_1",
+			wantStart: currentEnd,
+			wantEnd:   currentEnd.Add(subscriptionPeriod),
+		},
+		{
+			name:      "Event applied already doesn't stack another period",
+			existing:  &database.Subscription{Status: subscriptionStatusActive, CurrentPeriodEnd: currentEnd, LastEventID: sql.NullString{String: "evt_1", Valid: true}},
+			eventID:   "evt_1",
+			applied:   true,
+			wantStart: currentEnd,
+			wantEnd:   currentEnd.Add(subscriptionPeriod),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			userID := uuid.New()
+			if tt.existing != nil {
+				existing := *tt.existing
+				existing.ID = uuid.New()
+				existing.UserID = userID
+				expectQuery(mock, "GetSubscriptionByUserID").WithArgs(userID).WillReturnRows(subscriptionRows(existing))
+			} else {
+				expectQuery(mock, "GetSubscriptionByUserID").WithArgs(userID).WillReturnRows(subscriptionRows())
+			}
+			ctx := context.Background()
+			eventID := any(nil)
+			if tt.eventID != "" {
+				ctx = context.WithValue(ctx, webhookEventIDKey{}, tt.eventID)
+				eventID = tt.eventID
+			}
+			// The upsert leaves a subscription alone, and returns nothing,
+			// when the event was the last one applied to it.
+			rows := subscriptionRows(database.Subscription{ID: uuid.New(), UserID: userID})
+			if tt.applied {
+				rows = subscriptionRows()
+			}
+			expectQuery(mock, "UpsertSubscription").
+				WithArgs(subscriptionPlanChirpyRed, around(tt.wantStart), around(tt.wantEnd), userID, eventID).
+				WillReturnRows(rows)
+
+			err := cfg.renewSubscription(ctx, subscriptionData(t, userID, tt.periodEnd))
+			if err != nil {
+				t.Errorf("renewSubscription() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestEndSubscription(t *testing.T) {
+	tests := []struct {
+		name       string
+		end        func(*apiConfig, context.Context, json.RawMessage) error
+		wantStatus string
+		exists     bool
+	}{
+		{name: "Cancel", end: (*apiConfig).cancelSubscription, wantStatus: subscriptionStatusCanceled, exists: true},
+		{name: "Refund", end: (*apiConfig).refundSubscription, wantStatus: subscriptionStatusRefunded, exists: true},
+		{name: "Cancel missing subscription", end: (*apiConfig).cancelSubscription, wantStatus: subscriptionStatusCanceled},
+		{name: "Refund missing subscription", end: (*apiConfig).refundSubscription, wantStatus: subscriptionStatusRefunded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mock := newTestConfig(t)
+			userID := uuid.New()
+			rows := subscriptionRows()
+			if tt.exists {
+				rows = subscriptionRows(database.Subscription{ID: uuid.New(), Status: tt.wantStatus, UserID: userID})
+			}
+			expectQuery(mock, "EndSubscription").WithArgs(tt.wantStatus, userID).WillReturnRows(rows)
+
+			err := tt.end(cfg, context.Background(), subscriptionData(t, userID, nil))
+			if err != nil {
+				t.Errorf("endSubscription() error = %v", err)
+			}
+		})
+	}
+}